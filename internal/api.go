@@ -9,6 +9,7 @@ import (
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/controller"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
 )
 
 type Api struct {
@@ -26,6 +27,13 @@ func NewApi(cfg *config.Api) *Api {
 
 func (app *Api) Start() {
 	cfg := app.config.Http
+	applied, err := repo.Migrate(app.config.Repo, "migration")
+	if err != nil {
+		app.logger.Fatal(err)
+	}
+	for _, name := range applied {
+		app.logger.Printf("Applied migration %s", name)
+	}
 	handler := controller.NewRouter(app.config, app.logger)
 
 	app.server = &http.Server{
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+// Backup writes a snapshot of every repo database to a gzipped tar archive
+func Backup(cfg *config.Api, args []string) (err error) {
+	var fs = flag.NewFlagSet("backup", flag.ExitOnError)
+	var out = fs.String("out", fmt.Sprintf("backup-%s.tar.gz", time.Now().Format("20060102-150405")), "Output file")
+	fs.Parse(args)
+
+	file, err := os.Create(*out + ".tmp")
+	if err != nil {
+		return
+	}
+	m, err := repo.Backup(cfg.Repo, file)
+	if err2 := file.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(*out + ".tmp")
+		return
+	}
+	if err = os.Rename(*out+".tmp", *out); err != nil {
+		return
+	}
+	for name, n := range m.Keys {
+		log.Printf("%s: %d keys", name, n)
+	}
+	log.Printf("Wrote %s (version %016x)", *out, m.Version)
+	return
+}
+
+// Restore loads a backup archive written by Backup. The api must not be running.
+func Restore(cfg *config.Api, args []string) (err error) {
+	var fs = flag.NewFlagSet("restore", flag.ExitOnError)
+	var in = fs.String("in", "", "Backup archive")
+	var force = fs.Bool("force", false, "Delete existing data before restoring")
+	fs.Parse(args)
+	if len(*in) == 0 {
+		return fmt.Errorf("Backup archive required (-in)")
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	m, err := repo.Restore(cfg.Repo, file, *force)
+	if err != nil {
+		return
+	}
+	log.Printf("Restored %s (version %016x, created %s)", *in, m.Version, time.Unix(int64(m.Created), 0).Format(time.RFC3339))
+	return
+}
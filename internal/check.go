@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+// Check reports inconsistencies between repo databases, optionally repairing them
+func Check(cfg *config.Api, args []string) (err error) {
+	var fs = flag.NewFlagSet("check", flag.ExitOnError)
+	var repair = fs.Bool("repair", false, "Repair inconsistencies where possible")
+	fs.Parse(args)
+
+	issues, err := repo.Check(cfg.Repo, *repair)
+	var unrepaired int
+	for _, issue := range issues {
+		log.Println(issue)
+		if !issue.Repaired {
+			unrepaired++
+		}
+	}
+	if err != nil {
+		return
+	}
+	log.Printf("Found %d issues, %d repaired", len(issues), len(issues)-unrepaired)
+	if unrepaired > 0 {
+		err = fmt.Errorf("%d issues not repaired", unrepaired)
+	}
+	return
+}
@@ -6,6 +6,7 @@ type Api struct {
 	Twitch Twitch `yaml:"twitch"`
 	Secret string `yaml:"secret"`
 	Repo   Repos  `yaml:"repo"`
+	Hub    Hub    `yaml:"hub"`
 	Test   bool   `yaml:"test"`
 	Minify bool   `yaml:"minify"`
 	Hash   string `yaml:"hash"`
@@ -33,3 +34,17 @@ type Twitch struct {
 	OAuthRedirect string `yaml:"oauth_redirect"`
 	OidcIssuer    string `yaml:"oidc_issuer"`
 }
+
+// Hub configures the pub/sub transport connecting the socket hubs of every api instance.
+// Hubs only reach clients connected to the same process when no broker is configured.
+type Hub struct {
+	Redis *Redis `yaml:"redis"`
+	// SlowConsumer is the policy for clients not keeping up: disconnect, drop-oldest or coalesce
+	SlowConsumer string `yaml:"slow_consumer"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	Prefix   string `yaml:"prefix"`
+}
@@ -13,10 +13,45 @@ type Repos struct {
 	TileLock KeyValueStore `yaml:"tileLock"`
 }
 
+// ApplyGlobal places every repo without a database of its own in the global database
+// under a key prefix named after the repo
+func (r *Repos) ApplyGlobal() {
+	if r.Global == nil || !r.Global.Configured() {
+		return
+	}
+	for name, kvs := range map[string]*KeyValueStore{
+		"game":     &r.Game,
+		"user":     &r.User,
+		"love":     &r.Love,
+		"board":    &r.Board,
+		"fault":    &r.Fault,
+		"report":   &r.Report,
+		"userBan":  &r.UserBan,
+		"tileLock": &r.TileLock,
+	} {
+		if kvs.Configured() {
+			continue
+		}
+		var cache = kvs.Cache
+		*kvs = *r.Global
+		if cache != nil {
+			kvs.Cache = cache
+		}
+		kvs.Namespace = name
+	}
+}
+
 type KeyValueStore struct {
 	Cache      *RepoCache  `yaml:"cache"`
 	InMemoryDB *InMemoryDB `yaml:"inmemorydb"`
 	LevelDB    *LevelDB    `yaml:"leveldb"`
+	BoltDB     *BoltDB     `yaml:"boltdb"`
+	Namespace  string      `yaml:"namespace"`
+}
+
+// Configured returns true if the store has a database
+func (k *KeyValueStore) Configured() bool {
+	return k.InMemoryDB != nil || k.LevelDB != nil || k.BoltDB != nil
 }
 
 func (k *KeyValueStore) Override(t *KeyValueStore) {
@@ -26,6 +61,9 @@ func (k *KeyValueStore) Override(t *KeyValueStore) {
 	if t.LevelDB != nil && k.LevelDB != nil {
 		k.LevelDB.Override(t.LevelDB)
 	}
+	if t.BoltDB != nil && k.BoltDB != nil {
+		k.BoltDB.Override(t.BoltDB)
+	}
 }
 
 type InMemoryDB struct {
@@ -48,6 +86,16 @@ func (k *LevelDB) Override(t *LevelDB) {
 	}
 }
 
+type BoltDB struct {
+	Path string `yaml:"path"`
+}
+
+func (k *BoltDB) Override(t *BoltDB) {
+	if len(k.Path) > 0 && len(t.Path) == 0 {
+		t.Path = k.Path
+	}
+}
+
 type RepoCache struct {
 	Enabled bool `yaml:"enabled"`
 	Size    int  `yaml:"size"`
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+func newBackup(cfg *config.Api, logger *logrus.Logger) *backup {
+	return &backup{
+		cfg: cfg,
+		log: logger,
+	}
+}
+
+type backup struct {
+	cfg *config.Api
+	log *logrus.Logger
+}
+
+// ServeHTTP streams a backup archive of all game data
+func (c backup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !adminAuth(c.cfg, w, r) {
+		return
+	}
+	var name = fmt.Sprintf("backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	m, err := repo.Backup(c.cfg.Repo, w)
+	if err != nil {
+		// Headers are already sent so the truncated archive will fail to decompress
+		c.log.Errorf("Backup failed: %v", err)
+		return
+	}
+	c.log.Infof("Backup %s complete (version %016x)", name, m.Version)
+}
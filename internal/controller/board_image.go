@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/render"
+)
+
+func newBoardImage(logger *logrus.Logger, loader *render.Loader) *boardImage {
+	return &boardImage{
+		log:    logger,
+		loader: loader,
+	}
+}
+
+type boardImage struct {
+	log    *logrus.Logger
+	loader *render.Loader
+}
+
+func (c boardImage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	boardId, err := strconv.Atoi(vars["id"])
+	if err != nil || boardId > 0xffff {
+		http.Error(w, "Invalid board id", 400)
+		return
+	}
+	var timecode uint64
+	if t := r.FormValue("t"); len(t) > 0 {
+		if timecode, err = strconv.ParseUint(t, 10, 32); err != nil {
+			http.Error(w, "Invalid timecode", 400)
+			return
+		}
+	}
+	img, frames, err := c.loader.Load(uint16(boardId))
+	if err == errors.RepoItemNotFound {
+		http.Error(w, "Board not found", 404)
+		return
+	} else if err != nil {
+		c.log.Errorf("%v", err)
+		http.Error(w, "Unable to render board", 500)
+		return
+	}
+	img.Replay(frames, uint32(timecode))
+
+	b := bytes.NewBuffer(nil)
+	switch vars["ext"] {
+	case "gif":
+		w.Header().Set("Content-Type", "image/gif")
+		err = gif.Encode(b, img.Image(), nil)
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		err = png.Encode(b, img.Image())
+	}
+	if err != nil {
+		c.log.Errorf("%v", err)
+		http.Error(w, "Unable to encode image", 500)
+		return
+	}
+	if timecode > 0 {
+		w.Header().Set("Cache-Control", "max-age=900, stale-while-revalidate=86400")
+	} else {
+		w.Header().Set("Cache-Control", "max-age=15, stale-while-revalidate=60")
+	}
+	w.WriteHeader(200)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+var boardSnapshotInterval = 5 * time.Minute
+
+// runBoardSnapshots periodically brings the snapshot of every board in an active series up to date
+func runBoardSnapshots(logger *logrus.Logger, rGame repo.Game, rBoard repo.Board) {
+	for range time.Tick(boardSnapshotInterval) {
+		series, err := rGame.ActiveSeries()
+		if err != nil {
+			logger.Errorf("%v", err)
+			continue
+		}
+		for _, s := range series {
+			for _, b := range s.Boards {
+				if _, err = rBoard.UpdateSnapshot(b.ID); err != nil {
+					logger.Errorf("Board snapshot %04x: %v", b.ID, err)
+				}
+			}
+		}
+	}
+}
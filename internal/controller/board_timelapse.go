@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/render"
+)
+
+var timelapseMaxFrames = 1000
+
+func newBoardTimelapse(logger *logrus.Logger, loader *render.Loader) *boardTimelapse {
+	return &boardTimelapse{
+		log:    logger,
+		loader: loader,
+		cache:  newTimelapseCache(),
+	}
+}
+
+type boardTimelapse struct {
+	log    *logrus.Logger
+	loader *render.Loader
+	cache  *timelapseCache
+}
+
+func (c boardTimelapse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	boardId, err := strconv.Atoi(vars["id"])
+	if err != nil || boardId > 0xffff {
+		http.Error(w, "Invalid board id", 400)
+		return
+	}
+	var opts = render.DefaultTimelapseOptions
+	for k, v := range map[string]*int{
+		"step":  &opts.Step,
+		"max":   &opts.MaxFrames,
+		"delay": &opts.Delay,
+		"hold":  &opts.HoldDelay,
+	} {
+		if s := r.FormValue(k); len(s) > 0 {
+			if *v, err = strconv.Atoi(s); err != nil || *v < 0 {
+				http.Error(w, "Invalid "+k, 400)
+				return
+			}
+		}
+	}
+	if opts.MaxFrames < 2 || opts.MaxFrames > timelapseMaxFrames {
+		opts.MaxFrames = timelapseMaxFrames
+	}
+	img, frames, err := c.loader.Load(uint16(boardId))
+	if err == errors.RepoItemNotFound {
+		http.Error(w, "Board not found", 404)
+		return
+	} else if err != nil {
+		c.log.Errorf("%v", err)
+		http.Error(w, "Unable to render board", 500)
+		return
+	}
+
+	var key = timelapseKey{uint16(boardId), vars["ext"], opts}
+	var timecode uint32
+	if len(frames) > 0 {
+		timecode = frames[len(frames)-1].ID32()
+	}
+	data := c.cache.get(key, timecode, len(frames))
+	if data == nil {
+		err = c.cache.render(func() error {
+			// A concurrent request may have encoded it while waiting
+			if data = c.cache.get(key, timecode, len(frames)); data != nil {
+				return nil
+			}
+			b := bytes.NewBuffer(nil)
+			var err error
+			if key.ext == "zip" {
+				err = render.WriteTimelapsePNG(b, img, frames, opts)
+			} else {
+				err = render.WriteTimelapseGIF(b, img, frames, opts)
+			}
+			if err != nil {
+				return err
+			}
+			data = b.Bytes()
+			c.cache.put(key, &timelapse{timecode, len(frames), data})
+			return nil
+		})
+	}
+	if err != nil {
+		c.log.Errorf("%v", err)
+		http.Error(w, "Unable to encode timelapse", 500)
+		return
+	}
+	if key.ext == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "image/gif")
+	}
+	w.Header().Set("Cache-Control", "max-age=300, stale-while-revalidate=3600")
+	w.WriteHeader(200)
+	w.Write(data)
+}
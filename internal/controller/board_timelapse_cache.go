@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/render"
+)
+
+var (
+	// timelapseCacheSize is the number of encoded timelapses retained across boards and options
+	timelapseCacheSize = 32
+	// timelapseRenders is the number of timelapses encoded concurrently
+	timelapseRenders = 2
+)
+
+type timelapseKey struct {
+	boardId uint16
+	ext     string
+	opts    render.TimelapseOptions
+}
+
+// timelapse is an encoded timelapse along with the board's frames at the time it was encoded.
+// Frames removed by bans change the count without changing the last timecode.
+type timelapse struct {
+	timecode uint32
+	frames   int
+	data     []byte
+}
+
+// timelapseCache retains the most recently encoded timelapses until the board changes
+type timelapseCache struct {
+	entries map[timelapseKey]*timelapse
+	order   []timelapseKey
+	renders chan bool
+	mutex   sync.Mutex
+}
+
+func newTimelapseCache() *timelapseCache {
+	return &timelapseCache{
+		entries: map[timelapseKey]*timelapse{},
+		renders: make(chan bool, timelapseRenders),
+	}
+}
+
+// get returns the encoded timelapse if the board has not changed since it was encoded
+func (c *timelapseCache) get(k timelapseKey, timecode uint32, frames int) []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if t, ok := c.entries[k]; ok && t.timecode == timecode && t.frames == frames {
+		return t.data
+	}
+	return nil
+}
+
+// put retains an encoded timelapse evicting the oldest when full
+func (c *timelapseCache) put(k timelapseKey, t *timelapse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[k]; !ok {
+		c.order = append(c.order, k)
+	}
+	c.entries[k] = t
+	for len(c.order) > timelapseCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// render runs fn once a render slot is free
+func (c *timelapseCache) render(fn func() error) error {
+	c.renders <- true
+	defer func() { <-c.renders }()
+	return fn()
+}
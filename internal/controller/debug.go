@@ -64,16 +64,8 @@ type debug struct {
 
 func (c *debug) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	stdHeaders(w)
-	{
-		username := "admin"
-		password := c.cfg.Secret
-		user, pass, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Who goes there?"`)
-			w.WriteHeader(401)
-			w.Write([]byte("Unauthorised.\n"))
-			return
-		}
+	if !adminAuth(c.cfg, w, r) {
+		return
 	}
 	user, err := c.oauth.getUser(r, w)
 	if check(err, w, c.log) {
@@ -188,3 +180,17 @@ func (c *debug) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	w.Write(b.Bytes())
 }
+
+// adminAuth verifies admin basic auth credentials writing a 401 response if invalid
+func adminAuth(cfg *config.Api, w http.ResponseWriter, r *http.Request) bool {
+	username := "admin"
+	password := cfg.Secret
+	user, pass, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Who goes there?"`)
+		w.WriteHeader(401)
+		w.Write([]byte("Unauthorised.\n"))
+		return false
+	}
+	return true
+}
@@ -27,7 +27,7 @@ func (c login) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	var tokenBytes [255]byte
 	if _, err = rand.Read(tokenBytes[:]); err != nil {
-		c.log.Error("Couldn't generate a session - %s", err.Error())
+		c.log.Errorf("Couldn't generate a session - %s", err.Error())
 		http.Error(w, "Couldn't generate a session", 500)
 		return
 	}
@@ -36,7 +36,7 @@ func (c login) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	session.AddFlash(state, stateCallbackKey)
 
 	if err = session.Save(r, w); err != nil {
-		c.log.Error("Couldn't save session - %s", err.Error())
+		c.log.Errorf("Couldn't save session - %s", err.Error())
 		http.Error(w, "Couldn't save session", 500)
 		return
 	}
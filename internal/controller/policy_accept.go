@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -51,7 +52,7 @@ func (c policyAccept) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	user.Created = uint32(time.Now().Unix())
 	userID, inserted, err := c.repoUser.FindOrInsert(user)
 	if inserted {
-		c.hub.Broadcast(sock.TextMsgFromBytes("global", user.ToDto(userID)))
+		c.hub.Broadcast(sock.TextMsgFromBytes("global", user.ToDto(userID)).Coalesce(fmt.Sprintf("user-%d", userID)))
 	}
 	if err != nil {
 		http.Error(w, err.Error(), 500)
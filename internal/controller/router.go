@@ -7,6 +7,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/render"
 	"github.com/kevburnsjr/crypto-art-games/internal/repo"
 	sock "github.com/kevburnsjr/crypto-art-games/internal/socket"
 )
@@ -68,11 +69,28 @@ func NewRouter(cfg *config.Api, logger *logrus.Logger) *mux.Router {
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data: "+imgUrl+"; font-src 'self' data:; frame-src; script-src 'self'; style-src 'self'; connect-src 'self' "+wsUrl)
 	}
 
-	hub := sock.NewHub()
+	transport, err := sock.NewTransport(cfg.Hub)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	policy, err := sock.ParseSlowConsumerPolicy(cfg.Hub.SlowConsumer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	hub, err := sock.NewHub(transport, policy)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	go hub.Run()
 
+	go runBoardSnapshots(logger, rGame, rBoard)
+
+	go runTileLockSweeper(logger, rGame, rTileLock, rUser, hub)
+
 	oauth := newOAuth(cfg, logger, rUser)
 
+	loader := render.NewLoader("public", rGame, rBoard)
+
 	socket := newSocket(logger, oauth, hub, rGame, rUser, rLove, rBoard, rFault, rReport, rUserBan, rTileLock)
 
 	debug := newDebug(cfg, logger, oauth, hub, rGame, rUser, rLove, rBoard, rFault, rReport, rUserBan, rTileLock)
@@ -80,6 +98,8 @@ func NewRouter(cfg *config.Api, logger *logrus.Logger) *mux.Router {
 	router.Handle("/", index{})
 	router.Handle("/pixel-compactor", index{oauth, cfg, logger, hub, rUser})
 	router.Handle("/u/i/{id:[0-9]+}", newUserImage(rUser))
+	router.Handle("/b/{id:[0-9]+}.{ext:png|gif}", newBoardImage(logger, loader))
+	router.Handle("/b/{id:[0-9]+}/timelapse.{ext:gif|zip}", newBoardTimelapse(logger, loader))
 	router.Handle("/js/min.js", &staticMinJS{"public", cfg.Hash})
 	router.Handle("/login", newLogin(logger, oauth))
 	router.Handle("/logout", newLogout(logger, oauth))
@@ -89,6 +109,8 @@ func NewRouter(cfg *config.Api, logger *logrus.Logger) *mux.Router {
 	router.Handle("/oauth", oauth)
 	router.Handle("/socket", socket)
 	router.Handle("/debug", debug)
+	router.Handle("/debug/backup", newBackup(cfg, logger))
+	router.Handle("/debug/vars", newVars(cfg))
 	router.NotFoundHandler = &static{"public"}
 
 	return router
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,6 +17,8 @@ import (
 	sock "github.com/kevburnsjr/crypto-art-games/internal/socket"
 )
 
+var frameUndoWindow = 5 * time.Minute
+
 func newSocket(
 	logger *logrus.Logger,
 	oauth *oauth,
@@ -41,6 +44,7 @@ func newSocket(
 		repoReport:   rReport,
 		repoUserBan:  rUserBan,
 		repoTileLock: rTileLock,
+		sockets:      newUserSockets(),
 	}
 }
 
@@ -56,6 +60,7 @@ type socket struct {
 	repoReport   repo.Report
 	repoUserBan  repo.UserBan
 	repoTileLock repo.TileLock
+	sockets      *userSockets
 }
 
 func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -106,6 +111,21 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	conn := sock.CreateConnection(channels, ws)
+	go conn.Writer()
+
+	// Clients presenting an epoch receive sequenced broadcasts and resume channels from seq-<channel>
+	if q := r.URL.Query(); q["epoch"] != nil {
+		var seqs = map[string]uint32{}
+		for k := range q {
+			if !strings.HasPrefix(k, "seq-") {
+				continue
+			}
+			if n, err := strconv.ParseUint(q.Get(k), 10, 32); err == nil {
+				seqs[k[4:]] = uint32(n)
+			}
+		}
+		conn.Resume(q.Get("epoch"), seqs)
+	}
 
 	// Client thinks it's authed but user doesn't exist. Destroy session.
 	if user != nil && user.Policy && !found {
@@ -113,6 +133,7 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		conn.Write(sock.JsonMessage("", map[string]interface{}{
 			"type": "logout",
 		}))
+		conn.Close()
 		return
 	}
 
@@ -120,6 +141,7 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		c.log.Errorf("%v", err)
 		http.Error(w, "Unable to retrieve game version", 500)
+		conn.Close()
 		return
 	}
 
@@ -127,13 +149,15 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		c.log.Errorf("%v", err)
 		http.Error(w, "Unable to retrieve collections", 500)
+		conn.Close()
 		return
 	}
 
 	banIdxInt, _ := strconv.Atoi(r.FormValue("banIdx"))
 	userIdxInt, _ := strconv.Atoi(r.FormValue("userIdx"))
+	reportIdxInt, _ := strconv.Atoi(r.FormValue("reportIdx"))
 	var (
-		reportIdx = 0
+		reportIdx = uint32(reportIdxInt)
 		banIdx    = uint32(banIdxInt)
 		userIdx   = uint32(userIdxInt)
 	)
@@ -141,10 +165,13 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Sync new reports for mods
 	var reports []*entity.Report
 	if user != nil && user.Mod {
-		reports, err = c.repoReport.All()
+		reports, err = c.repoReport.Since(reportIdx)
 	}
 	for _, r := range reports {
 		conn.Write(sock.TextMsgFromBytes("", r.ToDto()))
+		if r.ID > reportIdx {
+			reportIdx = r.ID
+		}
 	}
 
 	// Sync new user bans
@@ -159,6 +186,7 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		c.log.Errorf("%v", err)
 		http.Error(w, "Unable to retrieve new users", 500)
+		conn.Close()
 		return
 	}
 	for i, user := range users {
@@ -176,8 +204,14 @@ func (c socket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"series":    series,
 	}))
 
+	if user != nil && user.Policy {
+		c.sockets.open(user.UserID)
+		conn.OnClose(func() {
+			c.sockets.close(user.UserID)
+			c.releaseTileLock(user.UserID)
+		})
+	}
 	c.hub.Register(conn)
-	go conn.Writer()
 	conn.Reader(c.hub, c.MsgHandler(user, conn))
 }
 
@@ -213,7 +247,40 @@ func (c socket) authMod(user *entity.User) (err error) {
 	return nil
 }
 
+// tileLockRequest reads the region of a tile-lock message. The region extends w tiles in x and
+// h tiles in y from tileID, each defaulting to a single tile.
+func tileLockRequest(m map[string]interface{}, board *entity.Board) (l *entity.TileLock, err error) {
+	ftid, ok := m["tileID"].(float64)
+	if !ok || ftid < 0 || ftid > 255 {
+		return nil, fmt.Errorf("Malformed Tile ID %v", m["tileID"])
+	}
+	l = &entity.TileLock{BoardID: board.ID, TileID: uint16(ftid)}
+	if l.Width, err = tileLockDimension(m, "w"); err != nil {
+		return
+	}
+	if l.Height, err = tileLockDimension(m, "h"); err != nil {
+		return
+	}
+	if l.Region() == nil || int(l.TileID/16)+int(l.Width) > int(board.Width) || int(l.TileID%16)+int(l.Height) > int(board.Height) {
+		return nil, fmt.Errorf("Tile lock region exceeds board")
+	}
+	return
+}
+
+func tileLockDimension(m map[string]interface{}, name string) (n uint8, err error) {
+	v, ok := m[name]
+	if !ok {
+		return 1, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 1 || f > 16 {
+		return 0, fmt.Errorf("Malformed tile lock %s %v", name, v)
+	}
+	return uint8(f), nil
+}
+
 func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.MessageHandler {
+	var series *entity.Series
 	var board *entity.Board
 	var boardId uint16
 	var boardChannel string
@@ -233,59 +300,106 @@ func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.Message
 				if err = c.auth(user); err != nil {
 					return
 				}
-				ftid, ok := m["tileID"].(float64)
-				if !ok {
-					err = fmt.Errorf("Malformed Tile ID %v", m["tileID"])
+				if board == nil {
+					err = fmt.Errorf("Board not initialized")
+					return
+				}
+				var l *entity.TileLock
+				if l, err = tileLockRequest(m, board); err != nil {
 					return
 				}
-				var tileID = uint16(ftid)
 				if err = user.Active(time.Now()); err != nil {
 					return
 				}
-				if err = c.repoUser.Consume(user, boardId); err != nil {
+				var n = int(l.Width) * int(l.Height)
+				if err = c.repoUser.Consume(user, board, n); err != nil {
 					return
 				}
-				if err = c.repoTileLock.Acquire(user.UserID, boardId, tileID, time.Now()); err != nil {
-					c.repoUser.Credit(user, boardId)
+				var displaced []*entity.TileLock
+				if displaced, err = c.repoTileLock.Acquire(user.UserID, boardId, l.TileID, l.Width, l.Height, time.Now()); err != nil {
+					c.repoUser.Credit(user, board, n)
 					return
 				}
+				for _, d := range displaced {
+					refundTileLock(c.log, c.repoGame, c.repoUser, c.hub, d, true)
+				}
 				c.hub.Broadcast(sock.JsonMessagePure(boardChannel, map[string]interface{}{
 					"type":   "tile-locked",
-					"tileID": tileID,
+					"tileID": l.TileID,
+					"w":      l.Width,
+					"h":      l.Height,
+					"tiles":  l.Region(),
 					"userID": user.UserID,
 					"bucket": user.Buckets[boardId],
-				}))
+				}).Coalesce(fmt.Sprintf("tile-%d", l.TileID)))
 			case "tile-lock-release":
 				if err = c.auth(user); err != nil {
 					return
 				}
-				var tileID = uint16(m["tileID"].(float64))
-				if err = c.repoUser.Credit(user, boardId); err != nil {
+				if board == nil {
+					err = fmt.Errorf("Board not initialized")
+					return
+				}
+				ftid, ok := m["tileID"].(float64)
+				if !ok {
+					err = fmt.Errorf("Malformed Tile ID %v", m["tileID"])
+					return
+				}
+				// Expired locks are refunded by the sweeper
+				var released *entity.TileLock
+				if released, err = c.repoTileLock.Release(user.UserID, boardId, uint16(ftid), time.Now()); err != nil {
 					return
 				}
-				if err = c.repoTileLock.Release(user.UserID, boardId, tileID, time.Now()); err != nil {
+				if err = c.repoUser.Credit(user, board, len(released.Tiles)); err != nil {
 					return
 				}
 				c.hub.Broadcast(sock.JsonMessagePure(boardChannel, map[string]interface{}{
 					"type":   "tile-lock-released",
-					"tileID": tileID,
+					"tileID": released.TileID,
+					"tiles":  released.Tiles,
 					"userID": user.UserID,
 					"bucket": user.Buckets[boardId],
-				}))
-			case "frame-undo":
+				}).Coalesce(fmt.Sprintf("tile-%d", released.TileID)))
+			case "frame-undo", "frame-redo":
 				if err = c.auth(user); err != nil {
 					return
 				}
-				// Insert frame undo
-				// Mark frame hidden
-				// Broadcast frame undo
-			case "frame-redo":
-				if err = c.auth(user); err != nil {
+				if board == nil {
+					err = fmt.Errorf("Board not initialized")
+					return
+				}
+				ftc, ok := m["timecode"].(float64)
+				if !ok || ftc < 0 || ftc > math.MaxUint32 {
+					err = fmt.Errorf("Malformed timecode %v", m["timecode"])
+					return
+				}
+				var since uint32
+				if t := uint32(time.Now().Add(-frameUndoWindow).Unix()); t > board.Created {
+					since = t - board.Created
+				}
+				var f *entity.Frame
+				var resType = "frame-undone"
+				if m["type"].(string) == "frame-undo" {
+					f, err = c.repoBoard.Undo(boardId, user.UserID, uint32(ftc), since)
+				} else {
+					f, err = c.repoBoard.Redo(boardId, user.UserID, uint32(ftc), since)
+					resType = "frame-redone"
+				}
+				if err != nil {
 					return
 				}
-				// Insert frame redo
-				// Mark frame unhidden
-				// Broadcast frame update
+				// Clients update the frame in place, saving it if they have not yet received it
+				c.hub.Broadcast(sock.JsonMessagePure(boardChannel, map[string]interface{}{
+					"type":     "frame-update",
+					"timecode": f.ID32(),
+					"deleted":  f.Deleted(),
+					"frame":    f.Data,
+				}))
+				res = sock.NewJsonRes(map[string]interface{}{
+					"type":     resType,
+					"timecode": f.ID32(),
+				})
+				return
 			case "love":
 				if err = c.auth(user); err != nil {
 					return
@@ -438,10 +552,15 @@ func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.Message
 				)
 				boardId = id
 				boardChannel = fmt.Sprintf("board-%04x", boardId)
-				board, err = c.repoGame.FindActiveBoard(boardId)
+				series, err = c.repoGame.FindActiveSeries(boardId)
 				if err != nil {
 					return
 				}
+				if series == nil {
+					err = fmt.Errorf("Board not active")
+					return
+				}
+				board = series.Board(boardId)
 				channels := conn.Channels()
 				for i, c := range channels {
 					if strings.HasPrefix(c, "board-") {
@@ -449,24 +568,60 @@ func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.Message
 					}
 				}
 				channels = append(channels, boardChannel)
+				if seq, ok := m["seq"].(float64); ok {
+					conn.Resume("", map[string]uint32{boardChannel: uint32(seq)})
+				}
 				c.hub.Update(conn, channels)
+				// Sync snapshot for clients requesting it on first load. Its composite tile frames stand in
+				// for the history up to the snapshot, so clients not requesting it are sent every frame.
+				var snapshot *entity.BoardSnapshot
+				if useSnapshot, _ := m["snapshot"].(bool); useSnapshot && timecode == 0 {
+					if snapshot, err = c.repoBoard.Snapshot(boardId); err != nil {
+						return
+					}
+				}
+				if snapshot != nil {
+					var tiles [][]byte
+					for _, f := range snapshot.TileList() {
+						tiles = append(tiles, f.Data)
+					}
+					conn.Write(sock.JsonMessage(boardChannel, map[string]interface{}{
+						"type":     "board-snapshot",
+						"timecode": snapshot.Timecode,
+						"tiles":    tiles,
+					}))
+					timecode = snapshot.Timecode
+				}
 				// Sync new frames
 				frames, err2 := c.repoBoard.Since(boardId, timecode)
 				if err2 != nil {
 					err = err2
 					return
 				}
-				timecode = 0
+				if snapshot != nil {
+					timecode = snapshot.Timecode - snapshot.Timecode%256
+				} else {
+					timecode = 0
+				}
 				for _, frame := range frames {
+					if snapshot != nil && frame.ID32() <= snapshot.Timecode {
+						continue
+					}
 					conn.Write(sock.BinaryMsgFromBytes(boardChannel, frame.Data))
 					timecode = frame.Timestamp() * 256
 				}
-				bucket := user.GetBucket(boardId)
+				locks, err2 := c.repoTileLock.Board(boardId, time.Now())
+				if err2 != nil {
+					err = err2
+					return
+				}
+				bucket := user.GetBucket(board, time.Now())
 				bucket.AdjustLevel(time.Now())
 				conn.Write(sock.JsonMessage(boardChannel, map[string]interface{}{
 					"type":     "board-init-complete",
 					"timecode": timecode,
 					"bucket":   bucket,
+					"locks":    locks,
 				}))
 			}
 			// c.hub.Broadcast(sock.TextMsgFromBytes(boardChannel, msg))
@@ -474,10 +629,17 @@ func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.Message
 			if err = c.auth(user); err != nil {
 				return
 			}
+			if board == nil {
+				err = fmt.Errorf("Board not initialized")
+				return
+			}
 			frame := &entity.Frame{
 				Data: msg,
 			}
-			if err = c.repoTileLock.Release(user.UserID, boardId, uint16(frame.TileID()), time.Now()); err != nil {
+			if err = frame.Validate(board, len(series.Palette.Colors)); err != nil {
+				return
+			}
+			if err = c.repoTileLock.Use(user.UserID, boardId, uint16(frame.TileID()), time.Now()); err != nil {
 				// User does not have lock
 				return
 			}
@@ -490,7 +652,7 @@ func (c socket) MsgHandler(user *entity.User, conn sock.Connection) sock.Message
 				"type":   "tile-lock-release",
 				"tileID": frame.TileID(),
 				"userID": user.UserID,
-			}))
+			}).Coalesce(fmt.Sprintf("tile-%d", frame.TileID())))
 			c.hub.Broadcast(sock.BinaryMsgFromBytes(boardChannel, frame.Data))
 		} else {
 			c.log.Debugf("Uknown: %d, %s", t, string(msg))
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+	sock "github.com/kevburnsjr/crypto-art-games/internal/socket"
+)
+
+// testSocket returns a socket controller backed by in memory repos and a running hub
+func testSocket(t *testing.T) *socket {
+	var cfg = config.Repos{Global: &config.KeyValueStore{InMemoryDB: &config.InMemoryDB{}}}
+	cfg.ApplyGlobal()
+	rGame, err := repo.NewGame(cfg.Game)
+	require.Nil(t, err)
+	rUser, err := repo.NewUser(cfg.User)
+	require.Nil(t, err)
+	rLove, err := repo.NewLove(cfg.Love)
+	require.Nil(t, err)
+	rBoard, err := repo.NewBoard(cfg.Board)
+	require.Nil(t, err)
+	rFault, err := repo.NewFault(cfg.Fault)
+	require.Nil(t, err)
+	rReport, err := repo.NewReport(cfg.Report)
+	require.Nil(t, err)
+	rUserBan, err := repo.NewUserBan(cfg.UserBan)
+	require.Nil(t, err)
+	rTileLock, err := repo.NewTileLock(cfg.TileLock)
+	require.Nil(t, err)
+	hub, err := sock.NewHub(sock.NewLocalBroker().Transport(), sock.Disconnect)
+	require.Nil(t, err)
+	go hub.Run()
+	return newSocket(logrus.New(), nil, hub, rGame, rUser, rLove, rBoard, rFault, rReport, rUserBan, rTileLock)
+}
+
+// testDial connects a websocket client handled by the controller on behalf of user
+func testDial(t *testing.T, c *socket, user *entity.User) *websocket.Conn {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			return
+		}
+		conn := sock.CreateConnection([]string{"global"}, ws)
+		c.hub.Register(conn)
+		go conn.Writer()
+		conn.Reader(c.hub, c.MsgHandler(user, conn))
+	}))
+	t.Cleanup(srv.Close)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.Nil(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// testRead returns the next text messages by type skipping binary messages
+func testRead(t *testing.T, ws *websocket.Conn, n int) map[string]map[string]interface{} {
+	var msgs = map[string]map[string]interface{}{}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	for len(msgs) < n {
+		mt, b, err := ws.ReadMessage()
+		require.Nil(t, err)
+		if mt != websocket.TextMessage {
+			continue
+		}
+		var m = map[string]interface{}{}
+		require.Nil(t, json.Unmarshal(b, &m))
+		msgs[m["type"].(string)] = m
+	}
+	return msgs
+}
+
+func TestSocketFrameUndoRedo(t *testing.T) {
+	c := testSocket(t)
+	var now = uint32(time.Now().Unix())
+	var series = &entity.Series{
+		Palette: entity.Palette{Colors: []string{"000000", "ffffff"}},
+		Boards:  []entity.Board{{ID: 1, Width: 16, Height: 16, TileSize: 16}},
+		Created: now - 3600,
+		Active:  now - 3600,
+	}
+	require.Nil(t, c.repoGame.InsertSeries(series))
+	var user = &entity.User{User: helix.User{ID: "1"}, Policy: true}
+	_, _, err := c.repoUser.FindOrInsert(user)
+	require.Nil(t, err)
+	f := entity.NewFrame(3590, 3, user.UserID, map[int]uint8{0: 1})
+	require.Nil(t, c.repoBoard.Insert(1, f))
+	var timecode = float64(f.ID32())
+
+	ws := testDial(t, c, user)
+	require.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "board-init", "boardId": 1, "timecode": 0}))
+	testRead(t, ws, 1)
+
+	require.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "frame-undo", "boardId": 1, "timecode": timecode}))
+	msgs := testRead(t, ws, 2)
+	require.Equal(t, timecode, msgs["frame-undone"]["timecode"])
+	require.Equal(t, timecode, msgs["frame-update"]["timecode"])
+	require.Equal(t, true, msgs["frame-update"]["deleted"])
+	frames, err := c.repoBoard.Since(1, 0)
+	require.Nil(t, err)
+	require.Len(t, frames, 0)
+
+	require.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "frame-redo", "boardId": 1, "timecode": timecode}))
+	msgs = testRead(t, ws, 2)
+	require.Equal(t, timecode, msgs["frame-redone"]["timecode"])
+	require.Equal(t, timecode, msgs["frame-update"]["timecode"])
+	require.Equal(t, false, msgs["frame-update"]["deleted"])
+	frames, err = c.repoBoard.Since(1, 0)
+	require.Nil(t, err)
+	require.Len(t, frames, 1)
+
+	// Frames are identified by timecode
+	require.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "frame-undo", "boardId": 1, "tileID": 3}))
+	msgs = testRead(t, ws, 1)
+	require.Contains(t, msgs["err"]["msg"], "Malformed timecode")
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// tileLockReleaseGrace is how long a user's tile lock outlives their last connection so that a
+// quick reconnect keeps the lock
+var tileLockReleaseGrace = 15 * time.Second
+
+// userSockets counts each user's open connections to this instance. Reconnects to another
+// instance are not counted so the lock is released once the grace period ends.
+type userSockets struct {
+	count map[uint32]int
+	mutex sync.Mutex
+}
+
+func newUserSockets() *userSockets {
+	return &userSockets{count: map[uint32]int{}}
+}
+
+func (s *userSockets) open(userID uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count[userID]++
+}
+
+func (s *userSockets) close(userID uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.count[userID]--; s.count[userID] <= 0 {
+		delete(s.count, userID)
+	}
+}
+
+func (s *userSockets) active(userID uint32) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count[userID] > 0
+}
+
+// releaseTileLock releases the user's tile locks after the grace period unless they reconnected
+func (c socket) releaseTileLock(userID uint32) {
+	time.AfterFunc(tileLockReleaseGrace, func() {
+		if c.sockets.active(userID) {
+			return
+		}
+		released, err := c.repoTileLock.ReleaseUser(userID, time.Now())
+		if err != nil {
+			c.log.Errorf("Tile lock release user %d: %v", userID, err)
+		}
+		for _, l := range released {
+			refundTileLock(c.log, c.repoGame, c.repoUser, c.hub, l, false)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+	sock "github.com/kevburnsjr/crypto-art-games/internal/socket"
+)
+
+var tileLockSweepInterval = 10 * time.Second
+
+// runTileLockSweeper periodically expires tile locks, refunding the credit consumed by each lock
+// and notifying the board that the tile is free
+func runTileLockSweeper(logger *logrus.Logger, rGame repo.Game, rTileLock repo.TileLock, rUser repo.User, hub sock.Hub) {
+	for range time.Tick(tileLockSweepInterval) {
+		expired, err := rTileLock.Sweep(time.Now())
+		if err != nil {
+			logger.Errorf("Tile lock sweep: %v", err)
+		}
+		for _, l := range expired {
+			refundTileLock(logger, rGame, rUser, hub, l, true)
+		}
+	}
+}
+
+// refundTileLock credits the owner of a released lock for each tile released and notifies the
+// board that the tiles are free
+func refundTileLock(logger *logrus.Logger, rGame repo.Game, rUser repo.User, hub sock.Hub, l *entity.TileLock, expired bool) {
+	series, err := rGame.FindSeriesByBoard(l.BoardID)
+	if err != nil || series == nil {
+		logger.Errorf("Tile lock refund board %d: %v", l.BoardID, err)
+		return
+	}
+	user, err := rUser.FindByUserID(l.UserID)
+	if err != nil {
+		logger.Errorf("Tile lock refund user %d: %v", l.UserID, err)
+		return
+	}
+	if err = rUser.Credit(user, series.Board(l.BoardID), len(l.Tiles)); err != nil {
+		logger.Errorf("Tile lock refund credit %d: %v", l.UserID, err)
+		return
+	}
+	hub.Broadcast(sock.JsonMessagePure(fmt.Sprintf("board-%04x", l.BoardID), map[string]interface{}{
+		"type":    "tile-lock-released",
+		"tileID":  l.TileID,
+		"tiles":   l.Tiles,
+		"userID":  l.UserID,
+		"bucket":  user.Buckets[l.BoardID],
+		"expired": expired,
+	}).Coalesce(fmt.Sprintf("tile-%d", l.TileID)))
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+)
+
+func newVars(cfg *config.Api) *vars {
+	return &vars{cfg: cfg}
+}
+
+type vars struct {
+	cfg *config.Api
+}
+
+// ServeHTTP exposes expvar metrics such as socket message drops to admins
+func (c vars) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !adminAuth(c.cfg, w, r) {
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -5,14 +5,23 @@ import (
 )
 
 type Board struct {
-	ID         uint16 `json:"id"`
-	Background string `json:"bg"`
-	Width      uint8  `json:"w"`
-	Height     uint8  `json:"h"`
-	TileSize   uint8  `json:"tsz"`
-	Created    uint32 `json:"created"`
-	Active     uint32 `json:"active"`
-	Finished   uint32 `json:"finished"`
+	ID         uint16   `json:"id"`
+	Background string   `json:"bg"`
+	Width      uint8    `json:"w"`
+	Height     uint8    `json:"h"`
+	TileSize   uint8    `json:"tsz"`
+	Created    uint32   `json:"created"`
+	Active     uint32   `json:"active"`
+	Finished   uint32   `json:"finished"`
+	Economy    *Economy `json:"economy,omitempty"`
+}
+
+// GetEconomy returns the board's economy or the default if none is set
+func (b *Board) GetEconomy() Economy {
+	if b == nil || b.Economy == nil {
+		return DefaultEconomy
+	}
+	return b.Economy.WithDefaults()
 }
 
 type BoardDto struct {
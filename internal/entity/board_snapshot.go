@@ -0,0 +1,114 @@
+package entity
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+// BoardSnapshot holds one composite frame per painted tile covering every frame up to Timecode
+type BoardSnapshot struct {
+	Timecode uint32
+	Tiles    map[uint8]*Frame
+}
+
+func NewBoardSnapshot() *BoardSnapshot {
+	return &BoardSnapshot{Tiles: map[uint8]*Frame{}}
+}
+
+// Apply paints a frame over the composite frame of its tile. The composite frame takes the
+// timecode and user of the tile's last frame so clients attribute it like the frame it replaces.
+func (s *BoardSnapshot) Apply(f *Frame) (err error) {
+	if f.Deleted() {
+		return
+	}
+	p, err := f.Pixels()
+	if err != nil {
+		return
+	}
+	var colors [FramePixelCount]int
+	for i := range colors {
+		colors[i] = -1
+	}
+	var set = func(p *FramePixels) {
+		var i int
+		for n, b := range p.Mask {
+			if b {
+				colors[n] = int(p.Colors[i])
+				i++
+			}
+		}
+	}
+	if tile, ok := s.Tiles[f.TileID()]; ok {
+		var prev *FramePixels
+		if prev, err = tile.Pixels(); err != nil {
+			return
+		}
+		set(prev)
+	}
+	set(p)
+	var res = &FramePixels{}
+	for n, c := range colors {
+		if c >= 0 {
+			res.Mask[n] = true
+			res.Colors = append(res.Colors, uint8(c))
+		}
+	}
+	var tile = &Frame{Data: make([]byte, FrameHeaderSize)}
+	tile.SetTimestamp(f.Timestamp())
+	tile.SetTileID(f.TileID())
+	tile.SetUserID(f.UserID())
+	if err = tile.SetPixels(res); err != nil {
+		return
+	}
+	s.Tiles[f.TileID()] = tile
+	if f.ID32() > s.Timecode {
+		s.Timecode = f.ID32()
+	}
+	return
+}
+
+// TileList returns composite tile frames ordered by tile id
+func (s *BoardSnapshot) TileList() (tiles []*Frame) {
+	for _, f := range s.Tiles {
+		tiles = append(tiles, f)
+	}
+	sort.Slice(tiles, func(i, j int) bool { return tiles[i].TileID() < tiles[j].TileID() })
+	return
+}
+
+// ToBytes encodes the snapshot as a 4 byte timecode followed by length prefixed tile frames
+func (s *BoardSnapshot) ToBytes() []byte {
+	var b = make([]byte, 4)
+	binary.BigEndian.PutUint32(b, s.Timecode)
+	var l = make([]byte, 2)
+	for _, f := range s.TileList() {
+		binary.BigEndian.PutUint16(l, uint16(len(f.Data)))
+		b = append(b, l...)
+		b = append(b, f.Data...)
+	}
+	return b
+}
+
+func BoardSnapshotFromBytes(b []byte) (s *BoardSnapshot, err error) {
+	if len(b) < 4 {
+		return nil, errors.FrameTruncated
+	}
+	s = NewBoardSnapshot()
+	s.Timecode = binary.BigEndian.Uint32(b[0:4])
+	for o := 4; o < len(b); {
+		if o+2 > len(b) {
+			return nil, errors.FrameTruncated
+		}
+		var n = int(binary.BigEndian.Uint16(b[o : o+2]))
+		o += 2
+		if n < FrameHeaderSize || o+n > len(b) {
+			return nil, errors.FrameTruncated
+		}
+		var f = &Frame{Data: append([]byte{}, b[o:o+n]...)}
+		s.Tiles[f.TileID()] = f
+		o += n
+	}
+	return
+}
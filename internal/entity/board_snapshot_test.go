@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoardSnapshot(t *testing.T) {
+	s := NewBoardSnapshot()
+	require.Nil(t, s.Apply(NewFrame(10, 3, 42, map[int]uint8{0: 1, 1: 2})))
+	require.Nil(t, s.Apply(NewFrame(11, 7, 42, map[int]uint8{255: 9})))
+	require.Nil(t, s.Apply(NewFrame(12, 3, 43, map[int]uint8{1: 4, 17: 5})))
+	deleted := NewFrame(13, 3, 42, map[int]uint8{0: 15})
+	deleted.SetDeleted(true)
+	require.Nil(t, s.Apply(deleted))
+
+	require.Equal(t, uint32(12*256+3), s.Timecode)
+	require.Equal(t, 2, len(s.Tiles))
+	p, err := s.Tiles[3].Pixels()
+	require.Nil(t, err)
+	require.Equal(t, []uint8{1, 4, 5}, p.Colors)
+	require.True(t, p.Mask[0] && p.Mask[1] && p.Mask[17])
+	require.Equal(t, uint32(12), s.Tiles[3].Timestamp())
+	// Attributed to the tile's last frame which shares its timecode
+	require.Equal(t, uint32(43), s.Tiles[3].UserID())
+
+	s2, err := BoardSnapshotFromBytes(s.ToBytes())
+	require.Nil(t, err)
+	require.Equal(t, s, s2)
+	require.Equal(t, uint8(3), s2.TileList()[0].TileID())
+
+	_, err = BoardSnapshotFromBytes(s.ToBytes()[:9])
+	require.NotNil(t, err)
+}
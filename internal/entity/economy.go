@@ -0,0 +1,36 @@
+package entity
+
+// Economy sets the tile credit bucket of each user on a board. Zero fields take the default.
+type Economy struct {
+	Size  uint8 `json:"size"`  // Maximum credits
+	Rate  uint8 `json:"rate"`  // Seconds to regenerate a quarter credit
+	Level uint8 `json:"level"` // Initial level in quarter credits
+	Cost  uint8 `json:"cost"`  // Credits consumed per tile locked
+}
+
+// DefaultEconomy applies to boards of series without an economy
+var DefaultEconomy = Economy{Size: 8, Rate: 15, Level: 32, Cost: 1}
+
+// WithDefaults returns the economy with zero fields replaced by the default
+func (e Economy) WithDefaults() Economy {
+	if e.Size == 0 {
+		e.Size = DefaultEconomy.Size
+	}
+	if e.Rate == 0 {
+		e.Rate = DefaultEconomy.Rate
+	}
+	if e.Level == 0 {
+		e.Level = DefaultEconomy.Level
+	}
+	if e.Cost == 0 {
+		e.Cost = DefaultEconomy.Cost
+	}
+	// Levels are stored in a byte
+	if e.Size > 63 {
+		e.Size = 63
+	}
+	if int(e.Level) > int(e.Size)*4 {
+		e.Level = e.Size * 4
+	}
+	return e
+}
@@ -16,3 +16,12 @@ func (u *Fault) ToJson() []byte {
 	b, _ := json.Marshal(u)
 	return b
 }
+
+func FaultFromJson(b []byte) *Fault {
+	var u Fault
+	err := json.Unmarshal(b, &u)
+	if err != nil {
+		return nil
+	}
+	return &u
+}
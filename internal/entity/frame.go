@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/bits"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 )
 
 var le = binary.LittleEndian
@@ -21,8 +23,56 @@ func FrameFromBytes(b []byte) *Frame {
 	}
 }
 
-func (f *Frame) Validate() error {
-	// TODO - Waiting to implement this until frame encoding is stable
+// NewFrame returns a frame painting colors by pixel index (x*16+y) or nil if the pixels cannot be
+// encoded
+func NewFrame(timestamp uint32, tileID uint8, userID uint32, pixels map[int]uint8) *Frame {
+	f := &Frame{Data: make([]byte, FrameHeaderSize)}
+	f.SetTimestamp(timestamp)
+	f.SetTileID(tileID)
+	f.SetUserID(userID)
+	var p = &FramePixels{}
+	for n := 0; n < FramePixelCount; n++ {
+		if c, ok := pixels[n]; ok {
+			p.Mask[n] = true
+			p.Colors = append(p.Colors, c)
+		}
+	}
+	if err := f.SetPixels(p); err != nil {
+		return nil
+	}
+	return f
+}
+
+// Validate rejects frames that could not have been produced by frame.toBytes for the given board
+func (f *Frame) Validate(board *Board, paletteSize int) error {
+	p, o, err := f.decode()
+	if err != nil {
+		return err
+	}
+	if int(f.TileID()/16) >= int(board.Width) || int(f.TileID()%16) >= int(board.Height) {
+		return errors.FrameOutOfBounds
+	}
+	if int(f.ColorCount()) > paletteSize {
+		return errors.FrameColorOverflow
+	}
+	var uniq = map[uint8]bool{}
+	for _, c := range p.Colors {
+		if int(c) >= paletteSize {
+			return errors.FrameColorOverflow
+		}
+		uniq[c] = true
+	}
+	if len(uniq) != int(f.ColorCount()) {
+		return errors.FrameMalformed
+	}
+	for n, b := range p.Mask {
+		if b && (n/16 >= int(board.TileSize) || n%16 >= int(board.TileSize)) {
+			return errors.FrameOutOfBounds
+		}
+	}
+	if len(f.Data) != (o+7)/8 || (o%8 > 0 && f.Data[o/8]>>(o%8) > 0) {
+		return errors.FrameTrailingData
+	}
 	return nil
 }
 
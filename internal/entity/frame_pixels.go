@@ -0,0 +1,382 @@
+package entity
+
+import (
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+const (
+	FrameHeaderSize = 8
+	FramePixelCount = 256
+	FrameMaxColors  = 16
+
+	frameFlagUseMask          = 60
+	frameFlagDeleted          = 61
+	frameFlagRLEMask          = 62
+	frameFlagRLEColorTable    = 63
+	frameRLEMaskInitial       = 0xffff
+	frameRunLengthMax         = 16
+	frameQuadCount            = 16
+	frameQuadSize             = 16
+	frameColorBits            = 4
+	framePositionBits         = 8
+	framePositionListMaxCount = 32
+)
+
+// FramePixels is the decoded pixel payload of a frame.
+// Mask is indexed by x*16+y (column major, matching public/js/tile.js).
+// Colors contains one palette index per set mask bit in ascending mask order.
+type FramePixels struct {
+	Mask   [FramePixelCount]bool
+	Colors []uint8
+}
+
+// Count returns the number of pixels set in the mask
+func (p *FramePixels) Count() (n int) {
+	for _, b := range p.Mask {
+		if b {
+			n++
+		}
+	}
+	return
+}
+
+// Each calls fn for every painted pixel with its tile relative coordinates and palette index
+func (p *FramePixels) Each(fn func(x, y int, c uint8)) {
+	var i int
+	for n, b := range p.Mask {
+		if !b {
+			continue
+		}
+		fn(n/16, n%16, p.Colors[i])
+		i++
+	}
+}
+
+func (f *Frame) ColorCount() uint8 { return f.getUint8(7)>>4 + 1 }
+
+func (f *Frame) flag(n int) bool { return f.Data[n/8]>>(n%8)&1 > 0 }
+
+// Pixels decodes the frame payload as written by frame.toBytes in public/js/frame.js
+func (f *Frame) Pixels() (p *FramePixels, err error) {
+	p, _, err = f.decode()
+	return
+}
+
+// decode decodes the frame payload returning the number of bits read
+func (f *Frame) decode() (p *FramePixels, o int, err error) {
+	if len(f.Data) < FrameHeaderSize {
+		err = errors.FrameTruncated
+		return
+	}
+	p = &FramePixels{}
+	r := &frameBitReader{b: f.Data, o: FrameHeaderSize * 8}
+	defer func() { o = r.o }()
+	var numpx int
+	if f.flag(frameFlagRLEMask) {
+		var quad, changed uint32 = frameRLEMaskInitial, 0
+		for i := 0; i < frameQuadCount; i++ {
+			if changed, err = r.read(1); err != nil {
+				return
+			}
+			if changed == 1 {
+				if quad, err = r.read(frameQuadSize); err != nil {
+					return
+				}
+			}
+			for j := 0; j < frameQuadSize; j++ {
+				if quad>>(frameQuadSize-1-j)&1 == 1 {
+					p.Mask[frameQuadIndex(i, j)] = true
+					numpx++
+				}
+			}
+		}
+	} else if f.flag(frameFlagUseMask) {
+		var b uint32
+		for i := 0; i < FramePixelCount; i++ {
+			if b, err = r.read(1); err != nil {
+				return
+			}
+			if b == 1 {
+				p.Mask[i] = true
+				numpx++
+			}
+		}
+	} else {
+		var n, pos uint32
+		if n, err = r.read(framePositionBits); err != nil {
+			return
+		}
+		var last = -1
+		for i := 0; i < int(n); i++ {
+			if pos, err = r.read(framePositionBits); err != nil {
+				return
+			}
+			if int(pos) <= last {
+				err = errors.FrameMalformed
+				return
+			}
+			last = int(pos)
+			p.Mask[pos] = true
+		}
+		numpx = int(n)
+	}
+	if numpx == 0 {
+		err = errors.FrameEmpty
+		return
+	}
+
+	var colorCount = int(f.ColorCount())
+	var bits = frameColorIndexBits(colorCount)
+
+	// Decode color index (if exists)
+	var cm []uint8
+	if bits < frameColorBits {
+		var c uint32
+		cm = make([]uint8, colorCount)
+		for i := range cm {
+			if c, err = r.read(frameColorBits); err != nil {
+				return
+			}
+			cm[i] = uint8(c)
+		}
+	}
+	var color = func(c uint32) (uint8, error) {
+		if cm == nil {
+			return uint8(c), nil
+		}
+		if int(c) >= len(cm) {
+			return 0, errors.FrameColorOverflow
+		}
+		return cm[c], nil
+	}
+
+	// Decode color table
+	p.Colors = make([]uint8, 0, numpx)
+	var n, c uint32
+	var ci uint8
+	if f.flag(frameFlagRLEColorTable) {
+		for len(p.Colors) < numpx {
+			if n, err = r.read(4); err != nil {
+				return
+			}
+			if c, err = r.read(bits); err != nil {
+				return
+			}
+			if ci, err = color(c); err != nil {
+				return
+			}
+			if len(p.Colors)+int(n)+1 > numpx {
+				err = errors.FrameRunOverflow
+				return
+			}
+			for i := 0; i <= int(n); i++ {
+				p.Colors = append(p.Colors, ci)
+			}
+		}
+	} else {
+		for i := 0; i < numpx; i++ {
+			if c, err = r.read(bits); err != nil {
+				return
+			}
+			if ci, err = color(c); err != nil {
+				return
+			}
+			p.Colors = append(p.Colors, ci)
+		}
+	}
+	return
+}
+
+// SetPixels encodes a pixel payload into the frame, preserving the timestamp, tile ID, user ID and
+// deleted flag. The output is bit for bit identical to frame.toBytes in public/js/frame.js.
+func (f *Frame) SetPixels(p *FramePixels) (err error) {
+	var numpx = p.Count()
+	if numpx == 0 {
+		return errors.FrameEmpty
+	}
+	if numpx != len(p.Colors) {
+		return errors.FrameMalformed
+	}
+	var colors = p.Colors
+	var uniq = map[uint8]bool{}
+	for _, c := range colors {
+		if c >= FrameMaxColors {
+			return errors.FrameColorOverflow
+		}
+		uniq[c] = true
+	}
+	var colorCount = len(uniq)
+	var bits = frameColorIndexBits(colorCount)
+
+	// Run length encoding may produce a smaller color table than simple enumeration
+	var runs, run int
+	for i := range colors {
+		if i == 0 || colors[i] != colors[i-1] || run == frameRunLengthMax {
+			runs++
+			run = 0
+		}
+		run++
+	}
+	var rleColorTable = bits > 0 && runs*(4+bits) < len(colors)*bits
+
+	// Run length encoding may produce a smaller mask than simple enumeration
+	var quads [frameQuadCount]uint32
+	var uniqQuads int
+	var prev uint32 = frameRLEMaskInitial
+	for i := range quads {
+		for j := 0; j < frameQuadSize; j++ {
+			quads[i] <<= 1
+			if p.Mask[frameQuadIndex(i, j)] {
+				quads[i] |= 1
+			}
+		}
+		if quads[i] != prev {
+			uniqQuads++
+			prev = quads[i]
+		}
+	}
+	var rleMask = 16*uniqQuads+16 < FramePixelCount && 16*uniqQuads+16 < len(colors)*8
+	var useMask = len(colors) >= framePositionListMaxCount
+
+	var header = make([]byte, FrameHeaderSize-1)
+	copy(header, f.Data)
+	w := &frameBitWriter{b: header, o: len(header) * 8}
+	w.write(frameColorBits, uint32(colorCount-1))
+	w.writeBool(useMask)
+	w.writeBool(len(f.Data) >= FrameHeaderSize && f.Deleted())
+	w.writeBool(rleMask)
+	w.writeBool(rleColorTable)
+
+	if rleMask {
+		prev = frameRLEMaskInitial
+		for _, quad := range quads {
+			if quad == prev {
+				w.write(1, 0)
+			} else {
+				w.write(1, 1)
+				w.write(frameQuadSize, quad)
+			}
+			prev = quad
+		}
+	} else if useMask {
+		for _, b := range p.Mask {
+			w.writeBool(b)
+		}
+	} else {
+		w.write(framePositionBits, uint32(len(colors)))
+		for i, b := range p.Mask {
+			if b {
+				w.write(framePositionBits, uint32(i))
+			}
+		}
+	}
+
+	var runLengthEncode = func(colors []uint8, cm map[uint8]uint8) {
+		var n uint32
+		for i, c := range colors {
+			if n == frameRunLengthMax-1 || i == len(colors)-1 || c != colors[i+1] {
+				w.write(4, n)
+				if cm != nil {
+					c = cm[c]
+				}
+				w.write(bits, uint32(c))
+				n = 0
+			} else {
+				n++
+			}
+		}
+	}
+
+	if bits == 0 {
+		w.write(frameColorBits, uint32(colors[0]))
+	} else if bits < frameColorBits {
+		var cm = map[uint8]uint8{}
+		var c []uint8
+		for _, color := range colors {
+			if _, ok := cm[color]; !ok {
+				cm[color] = uint8(len(c))
+				c = append(c, color)
+			}
+		}
+		// Color index
+		for _, color := range c {
+			w.write(frameColorBits, uint32(color))
+		}
+		if rleColorTable {
+			// Run length encoded pixel color indices
+			runLengthEncode(colors, cm)
+		} else {
+			// Enumerated pixel color indices
+			for _, color := range colors {
+				w.write(bits, uint32(cm[color]))
+			}
+		}
+	} else {
+		if rleColorTable {
+			// Run length encoded pixel colors
+			runLengthEncode(colors, nil)
+		} else {
+			// Enumerated pixel colors
+			for _, color := range colors {
+				w.write(bits, uint32(color))
+			}
+		}
+	}
+	f.Data = w.b
+	return
+}
+
+// frameQuadIndex maps bit j of quad i in a run length encoded mask to a mask index
+func frameQuadIndex(i, j int) int {
+	return (i%4)*4 + (i/4)*64 + (j/4)*16 + j%4
+}
+
+// frameColorIndexBits returns the number of bits required to address each color
+func frameColorIndexBits(colorCount int) (bits int) {
+	for 1<<bits < colorCount {
+		bits++
+	}
+	return
+}
+
+// frameBitReader reads big endian integers from a bitset packed least significant bit first
+type frameBitReader struct {
+	b []byte
+	o int
+}
+
+func (r *frameBitReader) read(bits int) (n uint32, err error) {
+	if r.o+bits > len(r.b)*8 {
+		err = errors.FrameTruncated
+		return
+	}
+	for j := 0; j < bits; j++ {
+		n = n<<1 | uint32(r.b[r.o/8]>>(r.o%8)&1)
+		r.o++
+	}
+	return
+}
+
+// frameBitWriter writes big endian integers to a bitset packed least significant bit first
+type frameBitWriter struct {
+	b []byte
+	o int
+}
+
+func (w *frameBitWriter) write(bits int, n uint32) {
+	for j := bits - 1; j >= 0; j-- {
+		if w.o/8 >= len(w.b) {
+			w.b = append(w.b, 0)
+		}
+		w.b[w.o/8] |= byte(n>>j&1) << (w.o % 8)
+		w.o++
+	}
+}
+
+func (w *frameBitWriter) writeBool(b bool) {
+	if b {
+		w.write(1, 1)
+	} else {
+		w.write(1, 0)
+	}
+}
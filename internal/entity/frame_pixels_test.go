@@ -0,0 +1,132 @@
+package entity
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+// Golden frames produced by frame.toBytes in public/js/frame.js
+var framePixelsTests = []struct {
+	name      string
+	hex       string
+	timestamp uint32
+	tileID    uint8
+	userID    uint32
+	deleted   bool
+	px        func() [][2]int
+}{
+	{"position-list", "008025ec0008960080000a", 420, 3*16 + 7, 4201, false, func() [][2]int {
+		return [][2]int{{0, 5}}
+	}},
+	{"position-list-index", "00c017ff0000800840c0139402", 1000, 255, 1, false, func() [][2]int {
+		return [][2]int{{3, 2}, {200, 9}}
+	}},
+	{"rle-mask", "0000b2800000c64493249324952499241000000080846118866108", 77, 1, 99, false, func() (px [][2]int) {
+		for k := 0; k < 20; k++ {
+			px = append(px, [2]int{k * 3, k % 3})
+		}
+		return
+	}},
+	{"rle-mask-full", "8047021100ffff5f000080c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f780c4a2e691d5b3f7", 123456, 8*16 + 8, 65535, false, func() (px [][2]int) {
+		for k := 0; k < 256; k++ {
+			px = append(px, [2]int{k, k % 16})
+		}
+		return
+	}},
+	{"rle-mask-rle-color-index", "0000a088000040d6000080c4a2f678389e4fe7ebe57abfdd9f8fe7fbf5fe00", 5, 17, 2, false, func() (px [][2]int) {
+		for k := 0; k < 256; k++ {
+			px = append(px, [2]int{k, k / 40})
+		}
+		return
+	}},
+	{"rle-mask-quadrant", "000090440000c0581000000048aaaaaaaaaaaaaaaa", 9, 34, 3, false, func() (px [][2]int) {
+		for k := 0; k < 64; k++ {
+			px = append(px, [2]int{k%4 + k/4%4*16 + k/16*4, 1 + k%2})
+		}
+		return
+	}},
+	{"deleted", "0000d0a200006020080008040c020a060e0109050d030b070f0e", 11, 4*16 + 5, 6, true, func() (px [][2]int) {
+		for k := 0; k < 16; k++ {
+			px = append(px, [2]int{k * 16, 7})
+		}
+		return
+	}},
+	{"rle-color", "008034c90000b2df232200000c8c4ccc2cac6cec1c9c5cdc3cbc7cfc", 300, 9*16 + 3, 77, false, func() (px [][2]int) {
+		for k := 0; k < 64; k++ {
+			px = append(px, [2]int{k * 4, k / 4})
+		}
+		return
+	}},
+	{"mask", "000030a2000060154110044110044110044110044110044110044110044110044110044110040000e05c46a91802ce65948a21e05c46a91802ce6594", 12, 4*16 + 5, 6, false, func() (px [][2]int) {
+		for k := 0; k < 40; k++ {
+			px = append(px, [2]int{k * 6, k * 7 % 11})
+		}
+		return
+	}},
+}
+
+func TestFramePixels(t *testing.T) {
+	for _, test := range framePixelsTests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := hex.DecodeString(test.hex)
+			require.Nil(t, err)
+			var expected = &FramePixels{}
+			for _, px := range test.px() {
+				expected.Mask[px[0]] = true
+				expected.Colors = append(expected.Colors, uint8(px[1]))
+			}
+
+			// Decode
+			f := &Frame{Data: data}
+			require.Equal(t, test.timestamp, f.Timestamp())
+			require.Equal(t, test.tileID, f.TileID())
+			require.Equal(t, test.userID, f.UserID())
+			require.Equal(t, test.deleted, f.Deleted())
+			p, err := f.Pixels()
+			require.Nil(t, err)
+			require.Equal(t, expected, p)
+
+			// Encode
+			f2 := &Frame{Data: make([]byte, FrameHeaderSize)}
+			f2.SetTimestamp(test.timestamp)
+			f2.SetTileID(test.tileID)
+			f2.SetUserID(test.userID)
+			f2.SetDeleted(test.deleted)
+			require.Nil(t, f2.SetPixels(expected))
+			require.Equal(t, test.hex, f2.DataHex())
+
+			// Re-encode preserves header
+			require.Nil(t, f.SetPixels(p))
+			require.Equal(t, test.hex, f.DataHex())
+		})
+	}
+}
+
+func TestFramePixelsEach(t *testing.T) {
+	var p = &FramePixels{Colors: []uint8{3, 4}}
+	p.Mask[1] = true
+	p.Mask[16*5+2] = true
+	var res [][3]int
+	p.Each(func(x, y int, c uint8) {
+		res = append(res, [3]int{x, y, int(c)})
+	})
+	require.Equal(t, [][3]int{{0, 1, 3}, {5, 2, 4}}, res)
+}
+
+func TestFramePixelsErrors(t *testing.T) {
+	data, _ := hex.DecodeString(framePixelsTests[2].hex)
+	for i := 0; i < len(data)-1; i++ {
+		_, err := (&Frame{Data: data[:i]}).Pixels()
+		require.Equal(t, errors.FrameTruncated, err, i)
+	}
+	require.Equal(t, errors.FrameEmpty, (&Frame{Data: make([]byte, 8)}).SetPixels(&FramePixels{}))
+	var p = &FramePixels{Colors: []uint8{16}}
+	p.Mask[0] = true
+	require.Equal(t, errors.FrameColorOverflow, (&Frame{Data: make([]byte, 8)}).SetPixels(p))
+	p.Colors = []uint8{1, 2}
+	require.Equal(t, errors.FrameMalformed, (&Frame{Data: make([]byte, 8)}).SetPixels(p))
+}
@@ -2,11 +2,14 @@ package entity
 
 import (
 	// "fmt"
+	"encoding/hex"
 	"math"
 	"testing"
 
 	// "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 )
 
 func TestFrameHeaders(t *testing.T) {
@@ -36,3 +39,67 @@ func TestFrameHeaders(t *testing.T) {
 	f.SetDeleted(true)
 	require.Equal(t, true, f.Deleted())
 }
+
+func TestFrameValidate(t *testing.T) {
+	var board = &Board{Width: 16, Height: 16, TileSize: 16}
+	var frame = func(s string) *Frame {
+		b, _ := hex.DecodeString(s)
+		return &Frame{Data: b}
+	}
+	for _, test := range framePixelsTests {
+		require.Nil(t, frame(test.hex).Validate(board, 16), test.name)
+	}
+	var single = framePixelsTests[0].hex
+	var two = framePixelsTests[1].hex
+
+	// Truncated
+	require.Equal(t, errors.FrameTruncated, frame(single[:14]).Validate(board, 16))
+	require.Equal(t, errors.FrameTruncated, frame(single[:20]).Validate(board, 16))
+
+	// Palette size
+	require.Equal(t, errors.FrameColorOverflow, frame(two).Validate(board, 8))
+	require.Equal(t, errors.FrameColorOverflow, frame(framePixelsTests[3].hex).Validate(board, 12))
+
+	// Tile outside board
+	require.Equal(t, errors.FrameOutOfBounds, frame(two).Validate(&Board{Width: 8, Height: 8, TileSize: 16}, 16))
+
+	// Pixel outside tile
+	require.Equal(t, errors.FrameOutOfBounds, frame(two).Validate(&Board{Width: 16, Height: 16, TileSize: 8}, 16))
+
+	// Trailing garbage
+	require.Equal(t, errors.FrameTrailingData, frame(single+"00").Validate(board, 16))
+	f := frame(single)
+	f.Data[len(f.Data)-1] |= 0x80
+	require.Equal(t, errors.FrameTrailingData, f.Validate(board, 16))
+
+	// Run length overflow
+	w := &frameBitWriter{b: make([]byte, 7), o: 56}
+	w.write(4, 0)
+	w.write(4, 1) // headerflag_runLengthEncodedColorTable
+	w.write(8, 2)
+	w.write(8, 0)
+	w.write(8, 1)
+	w.write(4, 3)
+	w.write(4, 2)
+	require.Equal(t, errors.FrameRunOverflow, (&Frame{Data: w.b}).Validate(board, 16))
+
+	// Color index out of range
+	w = &frameBitWriter{b: make([]byte, 7), o: 56}
+	w.write(4, 2)
+	w.write(4, 0)
+	w.write(8, 1)
+	w.write(8, 0)
+	w.write(12, 0x123)
+	w.write(2, 3)
+	require.Equal(t, errors.FrameColorOverflow, (&Frame{Data: w.b}).Validate(board, 16))
+
+	// Unsorted position list
+	w = &frameBitWriter{b: make([]byte, 7), o: 56}
+	w.write(4, 0)
+	w.write(4, 0)
+	w.write(8, 2)
+	w.write(8, 5)
+	w.write(8, 5)
+	w.write(4, 1)
+	require.Equal(t, errors.FrameMalformed, (&Frame{Data: w.b}).Validate(board, 16))
+}
@@ -26,3 +26,12 @@ func (u *Love) ToDto() []byte {
 	b, _ := json.Marshal(LoveDto{*u, "love"})
 	return b
 }
+
+func LoveFromJson(b []byte) *Love {
+	var u Love
+	err := json.Unmarshal(b, &u)
+	if err != nil {
+		return nil
+	}
+	return &u
+}
@@ -5,6 +5,7 @@ import (
 )
 
 type Report struct {
+	ID        uint32 `json:"id"`
 	TargetID  uint32 `json:"targetID"`
 	BoardID   uint16 `json:"boardID"`
 	Timecode  uint32 `json:"timecode"`
@@ -33,3 +34,12 @@ func (u *Report) ToDto() []byte {
 	b, _ := json.Marshal(ReportDto{*u, "report"})
 	return b
 }
+
+func ReportFromJson(b []byte) *Report {
+	var u Report
+	err := json.Unmarshal(b, &u)
+	if err != nil {
+		return nil
+	}
+	return &u
+}
@@ -6,14 +6,15 @@ import (
 )
 
 type Series struct {
-	ID       uint16  `json:"id"`
-	Name     string  `json:"name"`
-	Author   string  `json:"author"`
-	Palette  Palette `json:"palette"`
-	Boards   []Board `json:"boards"`
-	Created  uint32  `json:"created"`
-	Active   uint32  `json:"active"`
-	Finished uint32  `json:"finished"`
+	ID       uint16   `json:"id"`
+	Name     string   `json:"name"`
+	Author   string   `json:"author"`
+	Palette  Palette  `json:"palette"`
+	Boards   []Board  `json:"boards"`
+	Created  uint32   `json:"created"`
+	Active   uint32   `json:"active"`
+	Finished uint32   `json:"finished"`
+	Economy  *Economy `json:"economy,omitempty"` // Applies to boards without an economy
 }
 
 type SeriesList []*Series
@@ -27,6 +28,20 @@ func (s *Series) IDHex() string {
 	return fmt.Sprintf("%04x", s.ID)
 }
 
+// Board returns the series board with the given id
+func (s *Series) Board(id uint16) *Board {
+	for _, b := range s.Boards {
+		if b.ID == id {
+			b.Created = s.Created
+			if b.Economy == nil {
+				b.Economy = s.Economy
+			}
+			return &b
+		}
+	}
+	return nil
+}
+
 func SeriesFromJson(b []byte) *Series {
 	var res Series
 	err := json.Unmarshal(b, &res)
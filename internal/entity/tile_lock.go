@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"time"
+)
+
+// TileLock reserves a rectangular region of tiles on a board for a user. Tiles are numbered
+// x*16+y as in Frame.TileID and the region extends Width tiles in x and Height tiles in y from
+// TileID.
+type TileLock struct {
+	BoardID uint16   `json:"boardID"`
+	TileID  uint16   `json:"tileID"`
+	Width   uint8    `json:"w"`
+	Height  uint8    `json:"h"`
+	UserID  uint32   `json:"userID"`
+	Expires uint32   `json:"expires"`
+	Tiles   []uint16 `json:"tiles"` // Tiles in the region still held
+}
+
+// Expired returns true if the lock expired before t
+func (l *TileLock) Expired(t time.Time) bool {
+	return time.Unix(int64(l.Expires), 0).Before(t)
+}
+
+// Region returns every tile in the lock's region or nil if the region exceeds a 16x16 board
+func (l *TileLock) Region() (tiles []uint16) {
+	var x, y = int(l.TileID / 16), int(l.TileID % 16)
+	if l.Width == 0 || l.Height == 0 || x+int(l.Width) > 16 || y+int(l.Height) > 16 {
+		return nil
+	}
+	for i := 0; i < int(l.Width); i++ {
+		for j := 0; j < int(l.Height); j++ {
+			tiles = append(tiles, uint16((x+i)*16+y+j))
+		}
+	}
+	return
+}
+
+// Same returns true if both locks are the same acquisition regardless of the tiles still held
+func (l *TileLock) Same(l2 *TileLock) bool {
+	return l.BoardID == l2.BoardID &&
+		l.TileID == l2.TileID &&
+		l.Width == l2.Width &&
+		l.Height == l2.Height &&
+		l.UserID == l2.UserID &&
+		l.Expires == l2.Expires
+}
@@ -42,17 +42,21 @@ func (u *User) ToDto(userID uint32) []byte {
 	return b
 }
 
-func (u *User) GetBucket(boardID uint16) *UserBucket {
-	if u == nil {
+// GetBucket returns the user's bucket for a board creating it or upgrading it to the board's economy
+func (u *User) GetBucket(board *Board, t time.Time) *UserBucket {
+	if u == nil || board == nil {
 		return nil
 	}
 	if u.Buckets == nil {
 		u.Buckets = map[uint16]*UserBucket{}
 	}
-	if _, ok := u.Buckets[boardID]; !ok {
-		u.Buckets[boardID] = NewUserBucket(time.Now())
+	b, ok := u.Buckets[board.ID]
+	if !ok {
+		b = NewUserBucket(board.GetEconomy(), t)
+		u.Buckets[board.ID] = b
 	}
-	return u.Buckets[boardID]
+	b.Upgrade(board.GetEconomy(), t)
+	return b
 }
 
 func (u *User) IDHex() string {
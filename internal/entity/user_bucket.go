@@ -12,8 +12,25 @@ type UserBucket struct {
 	Timestamp uint32
 }
 
-func NewUserBucket(t time.Time) *UserBucket {
-	return &UserBucket{Size: 8, Level: 32, Rate: 15, Timestamp: uint32(t.Unix())}
+func NewUserBucket(e Economy, t time.Time) *UserBucket {
+	e = e.WithDefaults()
+	return &UserBucket{Size: e.Size, Level: e.Level, Rate: e.Rate, Timestamp: uint32(t.Unix())}
+}
+
+// Upgrade applies a change in the size or rate of an economy to the bucket. Credit regenerated
+// at the previous rate is retained up to the new size.
+func (b *UserBucket) Upgrade(e Economy, t time.Time) {
+	e = e.WithDefaults()
+	if b.Size == e.Size && b.Rate == e.Rate {
+		return
+	}
+	b.AdjustLevel(t)
+	b.Size = e.Size
+	b.Rate = e.Rate
+	b.Timestamp = uint32(t.Unix())
+	if b.Level > b.Size*4 {
+		b.Level = b.Size * 4
+	}
 }
 
 func (b *UserBucket) AdjustLevel(t time.Time) {
@@ -32,7 +49,7 @@ func (b *UserBucket) AdjustLevel(t time.Time) {
 
 func (b *UserBucket) Consume(n uint8, t time.Time) bool {
 	b.AdjustLevel(t)
-	if b.Level < n*4 {
+	if int(b.Level) < int(n)*4 {
 		return false
 	}
 	b.Level -= n * 4
@@ -41,9 +58,10 @@ func (b *UserBucket) Consume(n uint8, t time.Time) bool {
 
 func (b *UserBucket) Credit(n uint8, t time.Time) {
 	b.AdjustLevel(t)
-	b.Level = b.Level + n*4
-	if b.Level > b.Size*4 {
+	if int(b.Level)+int(n)*4 > int(b.Size)*4 {
 		b.Level = b.Size * 4
+	} else {
+		b.Level += n * 4
 	}
 }
 
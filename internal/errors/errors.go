@@ -4,6 +4,14 @@ const (
 	RepoDBUnavailable       = temporaryError("Could not open database")
 	RepoItemVersionConflict = err("Item version does not match")
 	RepoItemNotFound        = err("Item not found")
+
+	FrameTruncated     = err("Frame truncated")
+	FrameMalformed     = err("Frame malformed")
+	FrameColorOverflow = err("Frame color index out of range")
+	FrameRunOverflow   = err("Frame run length exceeds pixel count")
+	FrameEmpty         = err("Frame has no pixels")
+	FrameOutOfBounds   = err("Frame addresses pixels outside the tile")
+	FrameTrailingData  = err("Frame has trailing data")
 )
 
 func New(s string) error {
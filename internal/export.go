@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+// Export writes all entities as JSON Lines to a file or stdout
+func Export(cfg *config.Api, args []string) (err error) {
+	var fs = flag.NewFlagSet("export", flag.ExitOnError)
+	var out = fs.String("out", "-", "Output file (- for stdout)")
+	var scrub = fs.Bool("scrub", false, "Remove personal information from users and faults")
+	fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	counts, err := repo.Export(cfg.Repo, w, *scrub)
+	if err != nil {
+		return
+	}
+	for t, n := range counts {
+		log.Printf("Exported %d %s", n, t)
+	}
+	return
+}
+
+// Import loads a JSON Lines export from a file or stdin
+func Import(cfg *config.Api, args []string) (err error) {
+	var fs = flag.NewFlagSet("import", flag.ExitOnError)
+	var in = fs.String("in", "", "Input file (- for stdin)")
+	fs.Parse(args)
+	if len(*in) == 0 {
+		return fmt.Errorf("Input file required (-in)")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	counts, err := repo.Import(cfg.Repo, r)
+	for t, n := range counts {
+		log.Printf("Imported %d %s", n, t)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package render
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+// Board composites frames over a board background
+type Board struct {
+	board *entity.Board
+	img   *image.Paletted
+}
+
+// NewBoard returns a board compositor initialized with the board background quantized to the palette
+func NewBoard(board *entity.Board, palette entity.Palette, bg image.Image) (b *Board, err error) {
+	p, err := Palette(palette)
+	if err != nil {
+		return
+	}
+	var size = int(board.TileSize)
+	var rect = image.Rect(0, 0, int(board.Width)*size, int(board.Height)*size)
+	var img = image.NewPaletted(rect, p)
+	var bounds = bg.Bounds()
+	for x := 0; x < rect.Dx(); x++ {
+		for y := 0; y < rect.Dy(); y++ {
+			img.SetColorIndex(x, y, uint8(p.Index(bg.At(bounds.Min.X+x, bounds.Min.Y+y))))
+		}
+	}
+	return &Board{board, img}, nil
+}
+
+// Apply paints a frame onto the board
+func (b *Board) Apply(f *entity.Frame) (err error) {
+	px, err := f.Pixels()
+	if err != nil {
+		return
+	}
+	var size = int(b.board.TileSize)
+	var x1 = int(f.TileID()/16) * size
+	var y1 = int(f.TileID()%16) * size
+	var n = len(b.img.Palette)
+	px.Each(func(x, y int, c uint8) {
+		if x < size && y < size && int(c) < n {
+			b.img.SetColorIndex(x1+x, y1+y, c)
+		}
+	})
+	return
+}
+
+// Replay applies every frame up to and including timecode returning the number applied.
+// A timecode of 0 applies all frames. Frames that fail to decode are skipped.
+func (b *Board) Replay(frames []*entity.Frame, timecode uint32) (n int) {
+	for _, f := range frames {
+		if timecode > 0 && f.ID32() > timecode {
+			break
+		}
+		if f.Deleted() || b.Apply(f) != nil {
+			continue
+		}
+		n++
+	}
+	return
+}
+
+// Image returns a copy of the current board state
+func (b *Board) Image() *image.Paletted {
+	var img = image.NewPaletted(b.img.Rect, b.img.Palette)
+	copy(img.Pix, b.img.Pix)
+	return img
+}
+
+// Palette converts an entity palette to a color palette
+func Palette(palette entity.Palette) (p color.Palette, err error) {
+	for _, s := range palette.Colors {
+		var c []byte
+		if c, err = hex.DecodeString(s); err != nil || len(c) != 3 {
+			return nil, fmt.Errorf("Invalid palette color %s", s)
+		}
+		p = append(p, color.RGBA{c[0], c[1], c[2], 255})
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("Empty palette")
+	}
+	return
+}
+
+// LoadBackground reads a board background image from the static file root
+func LoadBackground(root string, board *entity.Board) (img image.Image, err error) {
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(filepath.Clean("/"+board.Background))))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	img, _, err = image.Decode(file)
+	return
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestBoard(t *testing.T) {
+	var palette = entity.Palette{Colors: []string{"000000", "ff0000", "00ff00", "0000ff"}}
+	var board = &entity.Board{Width: 2, Height: 2, TileSize: 16}
+	var bg = image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 32; y++ {
+			bg.Set(x, y, color.RGBA{10, 240, 20, 255})
+		}
+	}
+	b, err := NewBoard(board, palette, bg)
+	require.Nil(t, err)
+	require.Equal(t, uint8(2), b.Image().ColorIndexAt(0, 0))
+
+	var frames = []*entity.Frame{
+		entity.NewFrame(1, 0, 0, map[int]uint8{0: 1}),
+		entity.NewFrame(2, 17, 0, map[int]uint8{3*16 + 4: 3}),
+		entity.NewFrame(3, 1, 0, map[int]uint8{15*16 + 15: 0}),
+	}
+	require.Equal(t, 2, b.Replay(frames, frames[1].ID32()))
+	img := b.Image()
+	require.Equal(t, uint8(1), img.ColorIndexAt(0, 0))
+	require.Equal(t, uint8(3), img.ColorIndexAt(19, 20))
+	require.Equal(t, uint8(2), img.ColorIndexAt(15, 31))
+
+	require.Equal(t, 1, b.Replay(frames[2:], 0))
+	require.Equal(t, uint8(0), b.Image().ColorIndexAt(15, 31))
+	require.Equal(t, uint8(2), img.ColorIndexAt(15, 31))
+}
+
+func TestPalette(t *testing.T) {
+	p, err := Palette(entity.Palette{Colors: []string{"d1b187", "c77b58"}})
+	require.Nil(t, err)
+	require.Equal(t, color.RGBA{0xd1, 0xb1, 0x87, 255}, p[0])
+	_, err = Palette(entity.Palette{Colors: []string{"zzz"}})
+	require.NotNil(t, err)
+}
+
+func TestLoadBackground(t *testing.T) {
+	img, err := LoadBackground("../../public", &entity.Board{Background: "/palette/lost-century-01.gif"})
+	require.Nil(t, err)
+	require.Equal(t, 256, img.Bounds().Dx())
+	_, err = LoadBackground("../../public", &entity.Board{Background: "/../../go.mod"})
+	require.NotNil(t, err)
+}
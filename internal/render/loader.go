@@ -0,0 +1,45 @@
+package render
+
+import (
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+// NewLoader returns a Loader reading backgrounds from the static file root
+func NewLoader(root string, rGame repo.Game, rBoard repo.Board) *Loader {
+	return &Loader{
+		root:      root,
+		repoGame:  rGame,
+		repoBoard: rBoard,
+	}
+}
+
+// Loader builds board compositors from the game repositories
+type Loader struct {
+	root      string
+	repoGame  repo.Game
+	repoBoard repo.Board
+}
+
+// Load returns a compositor for the board background along with every live frame on the board
+func (l *Loader) Load(boardId uint16) (b *Board, frames []*entity.Frame, err error) {
+	series, err := l.repoGame.FindSeriesByBoard(boardId)
+	if err != nil {
+		return
+	}
+	if series == nil {
+		err = errors.RepoItemNotFound
+		return
+	}
+	board := series.Board(boardId)
+	bg, err := LoadBackground(l.root, board)
+	if err != nil {
+		return
+	}
+	if b, err = NewBoard(board, series.Palette, bg); err != nil {
+		return
+	}
+	frames, err = l.repoBoard.Since(boardId, 0)
+	return
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+// TimelapseOptions controls the number and pacing of timelapse frames
+type TimelapseOptions struct {
+	Step      int // Board frames applied per output frame
+	MaxFrames int // Maximum output frames. Step is increased to fit.
+	Delay     int // Delay between output frames (100ths of a second)
+	HoldDelay int // Delay on the final output frame (100ths of a second)
+}
+
+var DefaultTimelapseOptions = TimelapseOptions{
+	Step:      1,
+	MaxFrames: 300,
+	Delay:     4,
+	HoldDelay: 300,
+}
+
+// Timelapse replays frames over a board calling fn with the board state after every step.
+// The first call is the bare board and the last call always contains every frame.
+func Timelapse(b *Board, frames []*entity.Frame, opts TimelapseOptions, fn func(img *image.Paletted, last bool) error) (err error) {
+	var live []*entity.Frame
+	for _, f := range frames {
+		if !f.Deleted() {
+			live = append(live, f)
+		}
+	}
+	var step = opts.Step
+	if step < 1 {
+		step = 1
+	}
+	if opts.MaxFrames > 1 && (len(live)+step-1)/step+1 > opts.MaxFrames {
+		step = (len(live) + opts.MaxFrames - 2) / (opts.MaxFrames - 1)
+	}
+	if err = fn(b.Image(), len(live) == 0); err != nil {
+		return
+	}
+	for i := 0; i < len(live); i += step {
+		var end = i + step
+		if end > len(live) {
+			end = len(live)
+		}
+		b.Replay(live[i:end], 0)
+		if err = fn(b.Image(), end == len(live)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// TimelapseGIF renders an animated GIF. Each output frame after the first only contains the
+// rectangle of pixels that changed.
+func TimelapseGIF(b *Board, frames []*entity.Frame, opts TimelapseOptions) (anim *gif.GIF, err error) {
+	anim = &gif.GIF{}
+	var prev *image.Paletted
+	err = Timelapse(b, frames, opts, func(img *image.Paletted, last bool) error {
+		var delay = opts.Delay
+		if last {
+			delay = opts.HoldDelay
+		}
+		var frame = img
+		if prev != nil {
+			var r = changed(prev, img)
+			if r.Empty() {
+				if last {
+					anim.Delay[len(anim.Delay)-1] = delay
+				}
+				return nil
+			}
+			frame = img.SubImage(r).(*image.Paletted)
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		prev = img
+		return nil
+	})
+	return
+}
+
+// WriteTimelapseGIF writes an animated GIF to w
+func WriteTimelapseGIF(w io.Writer, b *Board, frames []*entity.Frame, opts TimelapseOptions) (err error) {
+	anim, err := TimelapseGIF(b, frames, opts)
+	if err != nil {
+		return
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// WriteTimelapsePNG writes a zip archive of numbered PNG frames to w suitable for
+// video encoders (ie. ffmpeg -i %05d.png timelapse.webm)
+func WriteTimelapsePNG(w io.Writer, b *Board, frames []*entity.Frame, opts TimelapseOptions) (err error) {
+	var z = zip.NewWriter(w)
+	var n int
+	err = Timelapse(b, frames, opts, func(img *image.Paletted, last bool) error {
+		f, err := z.Create(fmt.Sprintf("%05d.png", n))
+		if err != nil {
+			return err
+		}
+		n++
+		return png.Encode(f, img)
+	})
+	if err != nil {
+		return
+	}
+	return z.Close()
+}
+
+// changed returns the bounding rectangle of pixels that differ between two images
+func changed(a, b *image.Paletted) (r image.Rectangle) {
+	var bounds = b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.ColorIndexAt(x, y) != b.ColorIndexAt(x, y) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return
+}
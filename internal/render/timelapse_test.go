@@ -0,0 +1,80 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func testTimelapse(t *testing.T, n int) (*Board, []*entity.Frame) {
+	var palette = entity.Palette{Colors: []string{"000000", "ffffff"}}
+	var board = &entity.Board{Width: 1, Height: 1, TileSize: 16}
+	b, err := NewBoard(board, palette, image.NewRGBA(image.Rect(0, 0, 16, 16)))
+	require.Nil(t, err)
+	var frames []*entity.Frame
+	for i := 0; i < n; i++ {
+		frames = append(frames, entity.NewFrame(uint32(i+1), 0, 0, map[int]uint8{(i%16)*16 + i/16: 1}))
+	}
+	return b, frames
+}
+
+func TestTimelapse(t *testing.T) {
+	for _, test := range []struct {
+		frames   int
+		step     int
+		max      int
+		expected int
+	}{
+		{0, 1, 10, 1},
+		{5, 1, 10, 6},
+		{5, 2, 10, 4},
+		{100, 1, 10, 10},
+		{100, 1, 0, 101},
+		{99, 1, 10, 10},
+	} {
+		b, frames := testTimelapse(t, test.frames)
+		var n int
+		var final *image.Paletted
+		err := Timelapse(b, frames, TimelapseOptions{Step: test.step, MaxFrames: test.max}, func(img *image.Paletted, last bool) error {
+			n++
+			if last {
+				final = img
+			}
+			return nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, test.expected, n, test)
+		require.NotNil(t, final)
+		if test.frames > 0 {
+			require.Equal(t, uint8(1), final.ColorIndexAt((test.frames-1)%16, (test.frames-1)/16))
+		}
+	}
+}
+
+func TestTimelapseGIF(t *testing.T) {
+	b, frames := testTimelapse(t, 20)
+	var buf = bytes.NewBuffer(nil)
+	require.Nil(t, WriteTimelapseGIF(buf, b, frames, TimelapseOptions{Step: 4, Delay: 5, HoldDelay: 100}))
+	anim, err := gif.DecodeAll(buf)
+	require.Nil(t, err)
+	require.Equal(t, 6, len(anim.Image))
+	require.Equal(t, 100, anim.Delay[5])
+	require.Equal(t, image.Rect(0, 0, 16, 16), anim.Image[0].Bounds())
+	require.Equal(t, image.Rect(4, 0, 8, 1), anim.Image[2].Bounds())
+}
+
+func TestTimelapsePNG(t *testing.T) {
+	b, frames := testTimelapse(t, 3)
+	var buf = bytes.NewBuffer(nil)
+	require.Nil(t, WriteTimelapsePNG(buf, b, frames, DefaultTimelapseOptions))
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nil(t, err)
+	require.Equal(t, 4, len(z.File))
+	require.Equal(t, "00003.png", z.File[3].Name)
+}
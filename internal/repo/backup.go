@@ -0,0 +1,307 @@
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+)
+
+// BackupManifest describes a backup archive
+type BackupManifest struct {
+	Version uint64         `json:"version"`
+	Created uint32         `json:"created"`
+	Keys    map[string]int `json:"keys"`
+}
+
+const (
+	backupManifestName = "manifest.json"
+	backupExt          = ".kv"
+	backupBatchSize    = 1000
+)
+
+// Backup writes a gzipped tar archive containing a consistent snapshot of each repo database
+// followed by a manifest. Each database is snapshotted separately.
+func Backup(cfg config.Repos, w io.Writer) (m *BackupManifest, err error) {
+	stores, err := backupStores(cfg)
+	if err != nil {
+		return
+	}
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	m = &BackupManifest{
+		Created: uint32(time.Now().Unix()),
+		Keys:    map[string]int{},
+	}
+	if m.Version, err = rGame.Version(); err != nil {
+		return
+	}
+	var names []string
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		db, err := driver.New(stores[name])
+		if err != nil {
+			return nil, err
+		}
+		if db == nil {
+			continue
+		}
+		if m.Keys[name], err = backupDB(tw, name+backupExt, db); err != nil {
+			return nil, err
+		}
+	}
+	b, _ := json.MarshalIndent(m, "", "  ")
+	if err = writeBackupFile(tw, backupManifestName, b); err != nil {
+		return
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	err = gz.Close()
+	return
+}
+
+// Restore loads a backup archive into empty repo databases and verifies the restored key
+// counts against the manifest. Existing data is deleted first if force is true.
+func Restore(cfg config.Repos, r io.Reader, force bool) (m *BackupManifest, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	tr := tar.NewReader(gz)
+	var counts = map[string]int{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Name == backupManifestName {
+			m = &BackupManifest{}
+			if err = json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var name = strings.TrimSuffix(hdr.Name, backupExt)
+		store, ok := restoreStore(cfg, name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown database %s", hdr.Name)
+		}
+		db, err := driver.New(store)
+		if err != nil {
+			return nil, err
+		}
+		if db == nil {
+			return nil, fmt.Errorf("Database %s not configured", name)
+		}
+		if err = restoreClear(db, name, force); err != nil {
+			return nil, err
+		}
+		if counts[name], err = restoreDB(db, bufio.NewReader(tr)); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("Backup manifest missing")
+	}
+	for name, n := range m.Keys {
+		if counts[name] != n {
+			return m, fmt.Errorf("Restored %d keys to %s, expected %d", counts[name], name, n)
+		}
+	}
+	return
+}
+
+// repoStores returns the store of every repo other than board by name
+func repoStores(cfg config.Repos) map[string]config.KeyValueStore {
+	return map[string]config.KeyValueStore{
+		"game":     cfg.Game,
+		"user":     cfg.User,
+		"love":     cfg.Love,
+		"fault":    cfg.Fault,
+		"report":   cfg.Report,
+		"userBan":  cfg.UserBan,
+		"tileLock": cfg.TileLock,
+	}
+}
+
+// backupStores returns the store of every repo and every board of every series by name
+func backupStores(cfg config.Repos) (stores map[string]config.KeyValueStore, err error) {
+	stores = repoStores(cfg)
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	if rGame == nil {
+		return nil, fmt.Errorf("Game repo not configured")
+	}
+	all, err := rGame.AllSeries()
+	if err != nil {
+		return
+	}
+	for _, s := range all {
+		for _, b := range s.Boards {
+			stores[fmt.Sprintf("board-%04x", b.ID)] = BoardStore(cfg.Board, b.ID)
+		}
+	}
+	return
+}
+
+func restoreStore(cfg config.Repos, name string) (store config.KeyValueStore, ok bool) {
+	if strings.HasPrefix(name, "board-") {
+		id, err := strconv.ParseUint(name[6:], 16, 16)
+		if err != nil {
+			return
+		}
+		return BoardStore(cfg.Board, uint16(id)), true
+	}
+	store, ok = repoStores(cfg)[name]
+	return
+}
+
+// restoreClear ensures a database is empty, deleting all items if force is true
+func restoreClear(db driver.DB, name string, force bool) (err error) {
+	var keys [][]byte
+	err = db.Dump(nil, func(key, value []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return
+	}
+	if !force {
+		return fmt.Errorf("Database %s not empty", name)
+	}
+	batch := db.Batch()
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+	return batch.Write()
+}
+
+func restoreDB(db driver.DB, r *bufio.Reader) (n int, err error) {
+	batch := db.Batch()
+	for {
+		key, value, err := readBackupRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, err
+		}
+		batch.Put(key, value)
+		if n++; n%backupBatchSize == 0 {
+			if err = batch.Write(); err != nil {
+				return n, err
+			}
+			batch = db.Batch()
+		}
+	}
+	err = batch.Write()
+	return
+}
+
+// backupDB dumps a database to a temporary file to determine its size before adding it to the
+// archive so that large databases are not held in memory
+func backupDB(tw *tar.Writer, name string, db driver.DB) (n int, err error) {
+	f, err := os.CreateTemp("", "backup-*"+backupExt)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	err = db.Dump(nil, func(key, value []byte) error {
+		n++
+		return writeBackupRecord(w, key, value)
+	})
+	if err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(tw, f)
+	return
+}
+
+func writeBackupFile(tw *tar.Writer, name string, b []byte) (err error) {
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	_, err = tw.Write(b)
+	return
+}
+
+// writeBackupRecord writes a uvarint length prefixed key and value
+func writeBackupRecord(w io.Writer, key, value []byte) (err error) {
+	var l = make([]byte, binary.MaxVarintLen64)
+	for _, b := range [][]byte{key, value} {
+		if _, err = w.Write(l[:binary.PutUvarint(l, uint64(len(b)))]); err != nil {
+			return
+		}
+		if _, err = w.Write(b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func readBackupRecord(r *bufio.Reader) (key, value []byte, err error) {
+	var res [2][]byte
+	for i := range res {
+		l, err := binary.ReadUvarint(r)
+		if err == io.EOF && i == 1 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		res[i] = make([]byte, l)
+		if _, err = io.ReadFull(r, res[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return res[0], res[1], nil
+}
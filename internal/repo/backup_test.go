@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nicklaw5/helix"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func testRepos() config.Repos {
+	var cfg = config.Repos{Global: &config.KeyValueStore{InMemoryDB: &config.InMemoryDB{}}}
+	cfg.ApplyGlobal()
+	return cfg
+}
+
+func TestBackup(t *testing.T) {
+	src := testRepos()
+	rGame, _ := NewGame(src.Game)
+	require.Nil(t, rGame.InsertSeries(&entity.Series{Boards: []entity.Board{{ID: 1}, {ID: 2}}}))
+	rBoard, _ := NewBoard(src.Board)
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(10, 1, 7, map[int]uint8{0: 1})))
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(20, 1, 7, map[int]uint8{0: 1})))
+	require.Nil(t, rBoard.Insert(2, entity.NewFrame(30, 1, 7, map[int]uint8{0: 1})))
+	rUser, _ := NewUser(src.User)
+	_, _, err := rUser.FindOrInsert(&entity.User{User: helix.User{ID: "a"}})
+	require.Nil(t, err)
+	version, err := rGame.Version()
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	m, err := Backup(src, &buf)
+	require.Nil(t, err)
+	require.Equal(t, version, m.Version)
+	require.Equal(t, 2, m.Keys["board-0001"])
+	require.Equal(t, 1, m.Keys["board-0002"])
+	require.Equal(t, 3, m.Keys["user"])
+	var archive = buf.Bytes()
+
+	dst := testRepos()
+	m, err = Restore(dst, bytes.NewReader(archive), false)
+	require.Nil(t, err)
+	require.Equal(t, version, m.Version)
+
+	rGame, _ = NewGame(dst.Game)
+	v, err := rGame.Version()
+	require.Nil(t, err)
+	require.Equal(t, version, v)
+	s, err := rGame.FindSeriesByBoard(2)
+	require.Nil(t, err)
+	require.NotNil(t, s)
+	rBoard, _ = NewBoard(dst.Board)
+	frames, err := rBoard.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(frames))
+	rUser, _ = NewUser(dst.User)
+	_, found, err := rUser.Find(&entity.User{User: helix.User{ID: "a"}})
+	require.Nil(t, err)
+	require.True(t, found)
+
+	// Restore refuses to overwrite data unless forced
+	_, err = Restore(dst, bytes.NewReader(archive), false)
+	require.NotNil(t, err)
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(40, 1, 7, map[int]uint8{0: 1})))
+	_, err = Restore(dst, bytes.NewReader(archive), true)
+	require.Nil(t, err)
+	frames, err = rBoard.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(frames))
+}
@@ -3,9 +3,11 @@ package repo
 import (
 	"encoding/binary"
 	"fmt"
+	"sync"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
 )
 
@@ -13,19 +15,24 @@ type Board interface {
 	Find(boardId uint16, timecode uint32) (frame *entity.Frame, err error)
 	Insert(boardId uint16, frame *entity.Frame) (err error)
 	Since(boardId uint16, timecode uint32) (frames []*entity.Frame, err error)
+	All(boardId uint16) (frames []*entity.Frame, err error)
 	Update(boardId uint16, f *entity.Frame) (err error)
 	DeleteUserFramesAfter(boardId uint16, targetID, timestamp uint32) (deleted []uint32, err error)
 	Delete(boardId uint16, timecode uint32) (err error)
+	Snapshot(boardId uint16) (snapshot *entity.BoardSnapshot, err error)
+	UpdateSnapshot(boardId uint16) (snapshot *entity.BoardSnapshot, err error)
+	Undo(boardId uint16, userID uint32, timecode uint32, since uint32) (frame *entity.Frame, err error)
+	Redo(boardId uint16, userID uint32, timecode uint32, since uint32) (frame *entity.Frame, err error)
 }
 
+var boardSnapshotKey = []byte("_snapshot")
+
 // NewBoard returns an Frame repo instance
 func NewBoard(cfg config.KeyValueStore) (r *board, err error) {
 	var dbFactory func(uint16) (driver.DB, error)
-	if cfg.LevelDB != nil {
+	if cfg.Configured() {
 		dbFactory = func(boardId uint16) (driver.DB, error) {
-			dbcfg := *cfg.LevelDB
-			dbcfg.Path += fmt.Sprintf("-%04x", boardId)
-			return driver.NewLevelDB(dbcfg)
+			return driver.New(BoardStore(cfg, boardId))
 		}
 	}
 	if err != nil || dbFactory == nil {
@@ -37,12 +44,37 @@ func NewBoard(cfg config.KeyValueStore) (r *board, err error) {
 	}, nil
 }
 
+// BoardStore returns the store for a single board. Each board has its own LevelDB or BoltDB path
+// or otherwise its own namespace.
+func BoardStore(cfg config.KeyValueStore, boardId uint16) config.KeyValueStore {
+	var suffix = fmt.Sprintf("-%04x", boardId)
+	switch {
+	case len(cfg.Namespace) > 0:
+		cfg.Namespace += suffix
+	case cfg.LevelDB != nil:
+		ldbcfg := *cfg.LevelDB
+		ldbcfg.Path += suffix
+		cfg.LevelDB = &ldbcfg
+	case cfg.BoltDB != nil:
+		bdbcfg := *cfg.BoltDB
+		bdbcfg.Path += suffix
+		cfg.BoltDB = &bdbcfg
+	default:
+		cfg.Namespace = "board" + suffix
+	}
+	return cfg
+}
+
 type board struct {
 	dbMap     map[uint16]driver.DB
 	dbFactory func(uint16) (driver.DB, error)
+	mutex     sync.Mutex
+	snapMutex sync.Mutex
 }
 
 func (r *board) db(boardId uint16) (driver.DB, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	if db, ok := r.dbMap[boardId]; ok {
 		return db, nil
 	}
@@ -77,13 +109,81 @@ func (r *board) Insert(boardId uint16, f *entity.Frame) (err error) {
 	return
 }
 
-// Update updates a frame
+// Update updates a frame invalidating any snapshot covering it
 func (r *board) Update(boardId uint16, f *entity.Frame) (err error) {
 	db, err := r.db(boardId)
 	if err != nil {
 		return
 	}
-	_, err = db.Put(f.ID(), "", f.ToBytes())
+	r.snapMutex.Lock()
+	defer r.snapMutex.Unlock()
+	return r.update(db, f)
+}
+
+// update writes a frame deleting the snapshot if it covers the frame
+func (r *board) update(rw driver.ReadWriter, f *entity.Frame) (err error) {
+	_, b, err := rw.Get(boardSnapshotKey)
+	if err == nil && len(b) >= 4 && f.ID32() <= binary.BigEndian.Uint32(b[0:4]) {
+		err = rw.Delete(boardSnapshotKey, "")
+	} else if err == errors.RepoItemNotFound {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	_, err = rw.Put(f.ID(), "", f.ToBytes())
+	return
+}
+
+// Snapshot returns the most recent board snapshot or nil if none exists
+func (r *board) Snapshot(boardId uint16) (snapshot *entity.BoardSnapshot, err error) {
+	db, err := r.db(boardId)
+	if err != nil {
+		return
+	}
+	_, b, err := db.Get(boardSnapshotKey)
+	if err == errors.RepoItemNotFound {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	return entity.BoardSnapshotFromBytes(b)
+}
+
+// UpdateSnapshot applies all frames inserted since the last snapshot and stores the result
+func (r *board) UpdateSnapshot(boardId uint16) (snapshot *entity.BoardSnapshot, err error) {
+	db, err := r.db(boardId)
+	if err != nil {
+		return
+	}
+	r.snapMutex.Lock()
+	defer r.snapMutex.Unlock()
+	vers, b, err := db.Get(boardSnapshotKey)
+	if err == errors.RepoItemNotFound {
+		snapshot = entity.NewBoardSnapshot()
+		err = nil
+	} else if err != nil {
+		return
+	} else if snapshot, err = entity.BoardSnapshotFromBytes(b); err != nil {
+		return
+	}
+	frames, err := r.Since(boardId, snapshot.Timecode)
+	if err != nil {
+		return
+	}
+	var n int
+	for _, f := range frames {
+		if len(vers) > 0 && f.ID32() <= snapshot.Timecode {
+			continue
+		}
+		if snapshot.Apply(f) == nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	_, err = db.Put(boardSnapshotKey, vers, snapshot.ToBytes())
 	return
 }
 
@@ -95,7 +195,7 @@ func (r *board) Since(boardId uint16, timecode uint32) (frames []*entity.Frame,
 	}
 	var start = make([]byte, 4)
 	binary.BigEndian.PutUint32(start, timecode-timecode%256)
-	keys, vals, err := db.GetRanged(start, 0, false)
+	keys, vals, err := db.GetRanged(start, nil, 0, false)
 	if err != nil {
 		return
 	}
@@ -114,6 +214,25 @@ func (r *board) Since(boardId uint16, timecode uint32) (frames []*entity.Frame,
 	return
 }
 
+// All returns every frame including deleted frames
+func (r *board) All(boardId uint16) (frames []*entity.Frame, err error) {
+	db, err := r.db(boardId)
+	if err != nil {
+		return
+	}
+	keys, vals, err := db.GetRanged(nil, nil, 0, false)
+	if err != nil {
+		return
+	}
+	for i, b := range vals {
+		if len(keys[i]) != 4 {
+			continue
+		}
+		frames = append(frames, &entity.Frame{Data: b})
+	}
+	return
+}
+
 // Delete marks a frame as deleted
 func (r *board) Delete(boardId uint16, timecode uint32) (err error) {
 	f, err := r.Find(boardId, timecode)
@@ -124,6 +243,119 @@ func (r *board) Delete(boardId uint16, timecode uint32) (err error) {
 	return r.Update(boardId, f)
 }
 
+// Undo marks the frame at timecode as deleted provided it is the user's and the most recent frame
+// on its tile and it was painted after since. Repeated undos step back through the user's frames
+// and push each onto the user's redo stack for the tile.
+func (r *board) Undo(boardId uint16, userID uint32, timecode uint32, since uint32) (frame *entity.Frame, err error) {
+	db, err := r.db(boardId)
+	if err != nil {
+		return
+	}
+	frames, err := r.Since(boardId, since*256)
+	if err != nil {
+		return
+	}
+	var tileID = uint8(timecode)
+	for _, f := range frames {
+		if f.TileID() == tileID && f.Timestamp() >= since {
+			frame = f
+		}
+	}
+	if frame == nil || frame.ID32() != timecode || frame.UserID() != userID {
+		return nil, fmt.Errorf("No frame to undo")
+	}
+	frame.SetDeleted(true)
+	tx := driver.NewBatchTransaction(db, &r.snapMutex)
+	defer tx.Discard()
+	if err = r.update(tx, frame); err != nil {
+		return
+	}
+	var undoKey = boardUndoKey(userID, tileID)
+	_, stack, err := tx.Get(undoKey)
+	if err == errors.RepoItemNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	stack = append(append([]byte{}, stack...), frame.ID()...)
+	if len(stack) > boardUndoDepth*4 {
+		stack = stack[len(stack)-boardUndoDepth*4:]
+	}
+	if _, err = tx.Put(undoKey, "", stack); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// Redo restores the frame at timecode provided it is the user's most recently undone frame on its
+// tile, no other user has painted the tile since and it was painted after since. The redo stack is
+// discarded once its most recent frame can no longer be restored.
+func (r *board) Redo(boardId uint16, userID uint32, timecode uint32, since uint32) (frame *entity.Frame, err error) {
+	db, err := r.db(boardId)
+	if err != nil {
+		return
+	}
+	var tileID = uint8(timecode)
+	var undoKey = boardUndoKey(userID, tileID)
+	vers, stack, err := db.Get(undoKey)
+	if err == errors.RepoItemNotFound || err == nil && len(stack) < 4 {
+		return nil, fmt.Errorf("No frame to redo")
+	} else if err != nil {
+		return
+	}
+	frame, err = r.Find(boardId, binary.BigEndian.Uint32(stack[len(stack)-4:]))
+	if err == errors.RepoItemNotFound {
+		frame, err = nil, nil
+	} else if err != nil {
+		return
+	}
+	if frame == nil || !frame.Deleted() || frame.Timestamp() < since {
+		if err = db.Delete(undoKey, vers); err != nil {
+			return
+		}
+		return nil, fmt.Errorf("No frame to redo")
+	}
+	if frame.ID32() != timecode {
+		return nil, fmt.Errorf("No frame to redo")
+	}
+	frames, err := r.Since(boardId, frame.ID32())
+	if err != nil {
+		return
+	}
+	for _, f := range frames {
+		if f.TileID() == tileID && f.ID32() > frame.ID32() && f.UserID() != userID {
+			return nil, fmt.Errorf("Tile painted over")
+		}
+	}
+	frame.SetDeleted(false)
+	tx := driver.NewBatchTransaction(db, &r.snapMutex)
+	defer tx.Discard()
+	if err = r.update(tx, frame); err != nil {
+		return
+	}
+	if stack = stack[:len(stack)-4]; len(stack) > 0 {
+		_, err = tx.Put(undoKey, vers, stack)
+	} else {
+		err = tx.Delete(undoKey, vers)
+	}
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// boardUndoDepth is the number of undone frames retained per user and tile for redo
+const boardUndoDepth = 64
+
+func boardUndoKey(userID uint32, tileID uint8) []byte {
+	var key = append([]byte("_undo"), make([]byte, 5)...)
+	binary.BigEndian.PutUint32(key[5:9], userID)
+	key[9] = tileID
+	return key
+}
+
 // DeleteUserFramesAfter removes a users' contributions to the board
 func (r *board) DeleteUserFramesAfter(boardId uint16, targetID, timestamp uint32) (deleted []uint32, err error) {
 	db, err := r.db(boardId)
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func testInMemory() config.KeyValueStore {
+	return config.KeyValueStore{InMemoryDB: &config.InMemoryDB{}}
+}
+
+func TestBoard(t *testing.T) {
+	r, err := NewBoard(testInMemory())
+	require.Nil(t, err)
+	// Inserted out of order
+	for _, f := range []*entity.Frame{
+		entity.NewFrame(30, 1, 7, map[int]uint8{0: 1}),
+		entity.NewFrame(10, 1, 7, map[int]uint8{0: 1}),
+		entity.NewFrame(20, 2, 8, map[int]uint8{0: 1}),
+	} {
+		require.Nil(t, r.Insert(1, f))
+	}
+	frames, err := r.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(frames))
+	require.Equal(t, uint32(10), frames[0].Timestamp())
+	require.Equal(t, uint32(20), frames[1].Timestamp())
+	require.Equal(t, uint32(30), frames[2].Timestamp())
+
+	frames, err = r.Since(1, 20*256)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(frames))
+
+	// Boards are isolated
+	frames, err = r.Since(2, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(frames))
+
+	f, err := r.Find(1, 20*256+2)
+	require.Nil(t, err)
+	require.Equal(t, uint32(8), f.UserID())
+}
+
+func TestBoardUndoRedo(t *testing.T) {
+	r, err := NewBoard(testInMemory())
+	require.Nil(t, err)
+	require.Nil(t, r.Insert(1, entity.NewFrame(10, 1, 7, map[int]uint8{0: 1})))
+	require.Nil(t, r.Insert(1, entity.NewFrame(20, 1, 7, map[int]uint8{0: 1})))
+
+	snapshot, err := r.UpdateSnapshot(1)
+	require.Nil(t, err)
+	require.Equal(t, uint32(20*256+1), snapshot.Timecode)
+
+	// Only the user's most recent frame on the tile can be undone
+	_, err = r.Undo(1, 8, 20*256+1, 0)
+	require.NotNil(t, err)
+	_, err = r.Undo(1, 7, 10*256+1, 0)
+	require.NotNil(t, err)
+
+	f, err := r.Undo(1, 7, 20*256+1, 0)
+	require.Nil(t, err)
+	require.Equal(t, uint32(20), f.Timestamp())
+	frames, err := r.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(frames))
+
+	// Undo invalidates the snapshot covering the frame
+	snapshot, err = r.Snapshot(1)
+	require.Nil(t, err)
+	require.Nil(t, snapshot)
+
+	f, err = r.Redo(1, 7, 20*256+1, 0)
+	require.Nil(t, err)
+	require.False(t, f.Deleted())
+	frames, err = r.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(frames))
+
+	_, err = r.Redo(1, 7, 20*256+1, 0)
+	require.NotNil(t, err)
+
+	// Undos are redone in reverse order
+	for _, ts := range []uint32{20, 10} {
+		f, err = r.Undo(1, 7, ts*256+1, 0)
+		require.Nil(t, err)
+		require.Equal(t, ts, f.Timestamp())
+	}
+	_, err = r.Undo(1, 7, 10*256+1, 0)
+	require.NotNil(t, err)
+	_, err = r.Redo(1, 7, 20*256+1, 0)
+	require.NotNil(t, err)
+	for _, ts := range []uint32{10, 20} {
+		f, err = r.Redo(1, 7, ts*256+1, 0)
+		require.Nil(t, err)
+		require.Equal(t, ts, f.Timestamp())
+	}
+	_, err = r.Redo(1, 7, 20*256+1, 0)
+	require.NotNil(t, err)
+
+	// The stack is discarded once its most recent frame is outside the window
+	for _, ts := range []uint32{20, 10} {
+		_, err = r.Undo(1, 7, ts*256+1, 0)
+		require.Nil(t, err)
+	}
+	_, err = r.Redo(1, 7, 10*256+1, 15)
+	require.NotNil(t, err)
+	_, err = r.Redo(1, 7, 20*256+1, 0)
+	require.NotNil(t, err)
+}
+
+func TestBoardDeleteUserFramesAfter(t *testing.T) {
+	r, err := NewBoard(testInMemory())
+	require.Nil(t, err)
+	require.Nil(t, r.Insert(1, entity.NewFrame(10, 1, 7, map[int]uint8{0: 1})))
+	require.Nil(t, r.Insert(1, entity.NewFrame(20, 2, 8, map[int]uint8{0: 1})))
+	require.Nil(t, r.Insert(1, entity.NewFrame(30, 3, 7, map[int]uint8{0: 1})))
+
+	deleted, err := r.DeleteUserFramesAfter(1, 7, 15)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{30*256 + 3}, deleted)
+	frames, err := r.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(frames))
+}
+
+func TestBoardGlobal(t *testing.T) {
+	var cfg = config.Repos{Global: &config.KeyValueStore{InMemoryDB: &config.InMemoryDB{}}}
+	cfg.ApplyGlobal()
+	require.Equal(t, "board", cfg.Board.Namespace)
+	require.Equal(t, cfg.Global.InMemoryDB, cfg.User.InMemoryDB)
+
+	r, err := NewBoard(cfg.Board)
+	require.Nil(t, err)
+	require.Nil(t, r.Insert(1, entity.NewFrame(10, 1, 7, map[int]uint8{0: 1})))
+	require.Nil(t, r.Insert(2, entity.NewFrame(20, 1, 7, map[int]uint8{0: 1})))
+	frames, err := r.Since(1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(frames))
+	require.Equal(t, uint32(10), frames[0].Timestamp())
+
+	u, err := NewUser(cfg.User)
+	require.Nil(t, err)
+	_, _, err = u.FindOrInsert(&entity.User{})
+	require.Nil(t, err)
+	all, err := u.All()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(all))
+	frames, err = r.Since(2, 0)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(frames))
+}
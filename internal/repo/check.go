@@ -0,0 +1,379 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+)
+
+// CheckIssue is an inconsistency found by Check
+type CheckIssue struct {
+	DB       string
+	Key      []byte
+	Problem  string
+	Repaired bool
+}
+
+func (i *CheckIssue) String() string {
+	var s = fmt.Sprintf("%s %x: %s", i.DB, i.Key, i.Problem)
+	if i.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// Check walks every repo database reporting inconsistencies. Issues are repaired where possible
+// if repair is true. Repairs only delete dangling references, mark frames deleted, advance id
+// sequences or rewrite version prefixes so a check is safe to run against a live database.
+func Check(cfg config.Repos, repair bool) (issues []*CheckIssue, err error) {
+	var c = &checker{cfg: cfg, repair: repair}
+	for _, fn := range []func() error{
+		c.versions,
+		c.users,
+		c.tileLocks,
+		c.frames,
+		c.reports,
+		c.userBans,
+	} {
+		if err = fn(); err != nil {
+			return c.issues, err
+		}
+	}
+	return c.issues, nil
+}
+
+type checker struct {
+	cfg    config.Repos
+	repair bool
+	issues []*CheckIssue
+
+	// userIDs holds every user id found by the user check
+	userIDs map[uint32]bool
+}
+
+func (c *checker) issue(db string, key []byte, repaired bool, format string, args ...interface{}) {
+	c.issues = append(c.issues, &CheckIssue{
+		DB:       db,
+		Key:      append([]byte{}, key...),
+		Problem:  fmt.Sprintf(format, args...),
+		Repaired: repaired,
+	})
+}
+
+// versions verifies the version prefix of every stored value
+func (c *checker) versions() (err error) {
+	stores, err := backupStores(c.cfg)
+	if err != nil {
+		return
+	}
+	var names []string
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		db, err := driver.New(stores[name])
+		if err != nil {
+			return err
+		}
+		if db == nil {
+			continue
+		}
+		iter, err := db.Iterator()
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		for iter.Next() {
+			if !driver.Verify(iter.Value()) {
+				keys = append(keys, append([]byte{}, iter.Key()...))
+			}
+		}
+		err = iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			var repaired bool
+			if c.repair {
+				if repaired, err = checkRewrite(db, key); err != nil {
+					return err
+				}
+			}
+			c.issue(name, key, repaired, "Version does not match value")
+		}
+	}
+	return
+}
+
+// checkRewrite rewrites a value to recompute its version. Values too short to carry a version
+// can not be recovered.
+func checkRewrite(db driver.DB, key []byte) (ok bool, err error) {
+	vers, value, err := db.Get(key)
+	if err != nil || len(vers) == 0 {
+		return
+	}
+	_, err = db.Put(key, "", value)
+	return err == nil, err
+}
+
+// users verifies the twitch index and id sequence of the user repo
+func (c *checker) users() (err error) {
+	c.userIDs = map[uint32]bool{}
+	db, err := driver.New(c.cfg.User)
+	if err != nil || db == nil {
+		return
+	}
+	var maxID uint32
+	var idVers string
+	var seq uint32
+	var index = map[string]uint32{}
+	err = db.Dump(nil, func(key, value []byte) error {
+		switch {
+		case string(key) == "_id":
+			if len(value) == 4 {
+				seq = binary.BigEndian.Uint32(value)
+			}
+		case bytes.HasPrefix(key, []byte("twitch-")):
+			if len(value) == 4 {
+				index[string(key)] = binary.BigEndian.Uint32(value)
+			} else {
+				index[string(key)] = 0
+			}
+		case len(key) == 4:
+			id := binary.BigEndian.Uint32(key)
+			c.userIDs[id] = true
+			if id > maxID {
+				maxID = id
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if maxID > seq {
+		var repaired bool
+		if c.repair {
+			if idVers, _, err = db.Get([]byte("_id")); err != nil && err != errors.RepoItemNotFound {
+				return
+			}
+			var b = make([]byte, 4)
+			binary.BigEndian.PutUint32(b, maxID)
+			if _, err = db.Put([]byte("_id"), idVers, b); err != nil {
+				return
+			}
+			repaired = true
+		}
+		c.issue("user", []byte("_id"), repaired, "User %d greater than _id %d", maxID, seq)
+	}
+	var keys []string
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if c.userIDs[index[key]] {
+			continue
+		}
+		var repaired bool
+		if c.repair {
+			if err = db.Delete([]byte(key), ""); err != nil {
+				return
+			}
+			repaired = true
+		}
+		c.issue("user", []byte(key), repaired, "Index points to missing user %d", index[key])
+	}
+	return
+}
+
+// tileLocks verifies that every user entry refers to a lock held by that user on at least one tile
+func (c *checker) tileLocks() (err error) {
+	db, err := driver.New(c.cfg.TileLock)
+	if err != nil || db == nil {
+		return
+	}
+	var tiles = map[string]*entity.TileLock{}
+	var users = map[string][]byte{}
+	err = db.Dump(nil, func(key, value []byte) error {
+		switch {
+		case bytes.HasPrefix(key, tileLockTilePrefix):
+			tiles[string(key)] = tileLockFromKV(key, value)
+		case bytes.HasPrefix(key, tileLockUserPrefix):
+			users[string(key)] = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	var keys []string
+	for k := range users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var key = []byte(k)
+		var l *entity.TileLock
+		if len(key) == 7 {
+			l = tileLockFromValue(binary.BigEndian.Uint16(key[5:7]), 0, users[k])
+		}
+		var problem string
+		if l == nil || l.UserID != binary.BigEndian.Uint32(key[1:5]) {
+			problem = fmt.Sprintf("Invalid tile lock %x", users[k])
+		} else {
+			for _, tile := range l.Region() {
+				if current := tiles[string(tileLockTileKey(l.BoardID, tile))]; current != nil && current.Same(l) {
+					l.Tiles = append(l.Tiles, tile)
+				}
+			}
+			if len(l.Tiles) > 0 {
+				continue
+			}
+			problem = fmt.Sprintf("Tile lock on tile %02x not held", l.TileID)
+		}
+		var repaired bool
+		if c.repair {
+			if err = db.Delete(key, ""); err != nil {
+				return
+			}
+			repaired = true
+		}
+		c.issue("tileLock", key, repaired, "%s", problem)
+	}
+	return
+}
+
+// frames verifies that the user of every frame exists. Orphaned frames are not repaired.
+func (c *checker) frames() (err error) {
+	if !c.cfg.User.Configured() {
+		return
+	}
+	rGame, rBoard, err := c.boards()
+	if err != nil || rBoard == nil {
+		return
+	}
+	all, err := rGame.AllSeries()
+	if err != nil {
+		return
+	}
+	for _, s := range all {
+		for _, b := range s.Boards {
+			frames, err := rBoard.All(b.ID)
+			if err != nil {
+				return err
+			}
+			for _, f := range frames {
+				if len(f.Data) < 8 || c.userIDs[f.UserID()] {
+					continue
+				}
+				c.issue(fmt.Sprintf("board-%04x", b.ID), f.ID(), false, "Frame user %d not found", f.UserID())
+			}
+		}
+	}
+	return
+}
+
+// reports verifies that every report refers to an existing frame
+func (c *checker) reports() (err error) {
+	rReport, err := NewReport(c.cfg.Report)
+	if err != nil || rReport == nil {
+		return
+	}
+	_, rBoard, err := c.boards()
+	if err != nil || rBoard == nil {
+		return
+	}
+	keys, _, err := rReport.db.GetRanged(nil, nil, 0, false)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if len(key) != 14 {
+			continue
+		}
+		boardID := binary.BigEndian.Uint16(key[4:6])
+		timecode := binary.BigEndian.Uint32(key[6:10])
+		f, err := rBoard.Find(boardID, timecode)
+		if err != nil && err != errors.RepoItemNotFound {
+			return err
+		}
+		if f != nil && len(f.Data) > 0 {
+			continue
+		}
+		var repaired bool
+		if c.repair {
+			if err = rReport.db.Delete(key, ""); err != nil {
+				return err
+			}
+			repaired = true
+		}
+		c.issue("report", key, repaired, "Frame %08x on board %04x not found", timecode, boardID)
+	}
+	return
+}
+
+// userBans verifies that every frame removed by a ban is marked deleted
+func (c *checker) userBans() (err error) {
+	rUserBan, err := NewUserBan(c.cfg.UserBan)
+	if err != nil || rUserBan == nil {
+		return
+	}
+	_, rBoard, err := c.boards()
+	if err != nil || rBoard == nil {
+		return
+	}
+	bans, err := rUserBan.All()
+	if err != nil {
+		return
+	}
+	for _, ban := range bans {
+		if ban.FrameIDs == nil {
+			continue
+		}
+		var key = make([]byte, 4)
+		binary.BigEndian.PutUint32(key, ban.ID)
+		for boardID, timecodes := range *ban.FrameIDs {
+			for _, tc := range timecodes {
+				f, err := rBoard.Find(boardID, tc)
+				if err == errors.RepoItemNotFound {
+					c.issue("userBan", key, false, "Frame %08x on board %04x not found", tc, boardID)
+					continue
+				} else if err != nil {
+					return err
+				}
+				if f == nil || f.Deleted() {
+					continue
+				}
+				var repaired bool
+				if c.repair {
+					if err = rBoard.Delete(boardID, tc); err != nil {
+						return err
+					}
+					repaired = true
+				}
+				c.issue("userBan", key, repaired, "Frame %08x on board %04x not deleted", tc, boardID)
+			}
+		}
+	}
+	return
+}
+
+func (c *checker) boards() (rGame *game, rBoard *board, err error) {
+	if rGame, err = NewGame(c.cfg.Game); err != nil {
+		return
+	}
+	if rGame == nil {
+		return nil, nil, fmt.Errorf("Game repo not configured")
+	}
+	rBoard, err = NewBoard(c.cfg.Board)
+	return
+}
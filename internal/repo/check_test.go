@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/nicklaw5/helix"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestCheck(t *testing.T) {
+	cfg := testRepos()
+	rGame, _ := NewGame(cfg.Game)
+	require.Nil(t, rGame.InsertSeries(&entity.Series{Boards: []entity.Board{{ID: 1}}}))
+	rUser, _ := NewUser(cfg.User)
+	userID, _, err := rUser.FindOrInsert(&entity.User{User: helix.User{ID: "a"}})
+	require.Nil(t, err)
+	rBoard, _ := NewBoard(cfg.Board)
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(10, 1, userID, map[int]uint8{0: 1})))
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(20, 2, userID, map[int]uint8{0: 1})))
+	rReport, _ := NewReport(cfg.Report)
+	require.Nil(t, rReport.Insert(&entity.Report{TargetID: userID, BoardID: 1, Timecode: 10*256 + 1}))
+	rTileLock, _ := NewTileLock(cfg.TileLock)
+	_, err = rTileLock.Acquire(userID, 1, 3, 2, 2, time.Now())
+	require.Nil(t, err)
+
+	issues, err := Check(cfg, false)
+	require.Nil(t, err)
+	require.Len(t, issues, 0)
+
+	// Dangling twitch index and a user beyond the id sequence
+	var idBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(idBytes, 9)
+	_, err = rUser.db.Put([]byte("twitch-b"), "", idBytes)
+	require.Nil(t, err)
+	require.Nil(t, rUser.put(&entity.User{UserID: 5, User: helix.User{ID: "c"}}))
+	binary.BigEndian.PutUint32(idBytes, 1)
+	_, err = rUser.db.Put([]byte("_id"), "", idBytes)
+	require.Nil(t, err)
+	// User entry without a tile lock
+	_, err = rTileLock.db.Put(tileLockUserKey(5, 1), "", tileLockValue(&entity.TileLock{BoardID: 1, TileID: 4, Width: 1, Height: 1, UserID: 5}))
+	require.Nil(t, err)
+	// Frame by a missing user
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(30, 1, 7, map[int]uint8{0: 1})))
+	// Report against a missing frame
+	require.Nil(t, rReport.Insert(&entity.Report{TargetID: userID, BoardID: 1, Timecode: 40*256 + 1}))
+	// Ban whose frames were not deleted
+	rUserBan, _ := NewUserBan(cfg.UserBan)
+	require.Nil(t, rUserBan.Insert(&entity.UserBan{
+		TargetID: userID,
+		FrameIDs: &map[uint16][]uint32{1: {20*256 + 2}},
+	}))
+
+	issues, err = Check(cfg, false)
+	require.Nil(t, err)
+	require.Len(t, issues, 6)
+	for _, issue := range issues {
+		require.False(t, issue.Repaired)
+	}
+
+	issues, err = Check(cfg, true)
+	require.Nil(t, err)
+	require.Len(t, issues, 6)
+	for _, issue := range issues {
+		require.Equal(t, issue.DB != "board-0001", issue.Repaired, issue.String())
+	}
+	f, err := rBoard.Find(1, 20*256+2)
+	require.Nil(t, err)
+	require.True(t, f.Deleted())
+
+	// Only the orphaned frame remains
+	issues, err = Check(cfg, true)
+	require.Nil(t, err)
+	require.Len(t, issues, 1)
+	require.Equal(t, "board-0001", issues[0].DB)
+}
@@ -0,0 +1,83 @@
+package driver
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+// NewBatchTransaction returns a Transaction holding mutex until it is committed or discarded.
+// Writes are buffered, visible to its own reads and committed atomically as a Batch. Unlike
+// OpenTransaction it does not block other writers to the DB, so every read-modify-write of the
+// keys it touches must hold the same mutex. Suited to frequent small writes.
+func NewBatchTransaction(db DB, mutex *sync.Mutex) Transaction {
+	mutex.Lock()
+	return &batchTransaction{
+		db:      db,
+		batch:   db.Batch(),
+		pending: map[string][]byte{},
+		mutex:   mutex,
+	}
+}
+
+type batchTransaction struct {
+	db      DB
+	batch   Batch
+	pending map[string][]byte // A nil value marks a delete
+	mutex   *sync.Mutex
+	closed  bool
+}
+
+func (t *batchTransaction) Get(key []byte) (vers string, value []byte, err error) {
+	if v, ok := t.pending[string(key)]; ok {
+		if v == nil {
+			return "", nil, errors.RepoItemNotFound
+		}
+		return version(v), v, nil
+	}
+	return t.db.Get(key)
+}
+
+func (t *batchTransaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	v, _, err := t.Get(key)
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	value = append([]byte{}, value...)
+	t.pending[string(key)] = value
+	t.batch.Put(append([]byte{}, key...), value)
+	return version(value), nil
+}
+
+func (t *batchTransaction) Delete(key []byte, prev string) (err error) {
+	v, _, err := t.Get(key)
+	if err == errors.RepoItemNotFound {
+		return nil
+	}
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	t.pending[string(key)] = nil
+	t.batch.Delete(append([]byte{}, key...))
+	return
+}
+
+func (t *batchTransaction) Commit() (err error) {
+	if t.closed {
+		return fmt.Errorf("Transaction closed")
+	}
+	defer t.Discard()
+	if len(t.pending) == 0 {
+		return
+	}
+	return t.batch.Write()
+}
+
+func (t *batchTransaction) Discard() {
+	if t.closed {
+		return
+	}
+	t.closed = true
+	t.mutex.Unlock()
+}
@@ -0,0 +1,361 @@
+package driver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+var (
+	boltInstances = map[string]*boltDriver{}
+	boltMutex     sync.Mutex
+	boltBucket    = []byte("kv")
+)
+
+func NewBoltDB(cfg config.BoltDB) (w *boltDriver, err error) {
+	boltMutex.Lock()
+	defer boltMutex.Unlock()
+	w, ok := boltInstances[cfg.Path]
+	if !ok {
+		if err = os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+			return nil, errors.RepoDBUnavailable
+		}
+		db, err := bolt.Open(cfg.Path, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, errors.RepoDBUnavailable
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(boltBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, errors.RepoDBUnavailable
+		}
+		w = &boltDriver{db: db, path: cfg.Path}
+		boltInstances[cfg.Path] = w
+	}
+	return
+}
+
+// boltDriver stores all items in a single bucket of a bbolt file.
+// Iterators do not hold a read transaction open between moves since bbolt cannot remap its
+// data file for a write while any read transaction is open.
+type boltDriver struct {
+	db   *bolt.DB
+	path string
+}
+
+func (w *boltDriver) Get(key []byte) (version string, value []byte, err error) {
+	err = w.db.View(func(tx *bolt.Tx) error {
+		version, value, err = boltGet(tx.Bucket(boltBucket), key)
+		return err
+	})
+	return
+}
+
+func (w *boltDriver) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		vers, err = boltPut(tx.Bucket(boltBucket), key, prev, value)
+		return err
+	})
+	return
+}
+
+func (w *boltDriver) Delete(key []byte, prev string) (err error) {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		return boltDelete(tx.Bucket(boltBucket), key, prev)
+	})
+}
+
+func (w *boltDriver) Has(key []byte) (exists bool, err error) {
+	err = w.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltBucket).Get(key) != nil
+		return nil
+	})
+	return
+}
+
+func (w *boltDriver) PutRanged(id, date string, value []byte) (err error) {
+	key := id + "-" + date
+	return w.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), value)
+	})
+}
+
+func (w *boltDriver) GetRanged(start, end []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
+	err = w.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		var k, v []byte
+		var next = c.Next
+		if reverse {
+			next = c.Prev
+			if end == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(end); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		} else {
+			k, v = c.Seek(start)
+		}
+		for ; k != nil; k, v = next() {
+			if bytes.Compare(k, start) < 0 || (end != nil && bytes.Compare(k, end) >= 0) {
+				break
+			}
+			keys = append(keys, append([]byte{}, k...))
+			values = append(values, append([]byte{}, v[16:]...))
+			if limit > 0 && len(values) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (w *boltDriver) PrefixIterator(prefix []byte) (Iterator, error) {
+	return &bolt_iterator{db: w.db, prefix: prefix, dir: -1}, nil
+}
+
+func (w *boltDriver) Iterator() (Iterator, error) {
+	return &bolt_iterator{db: w.db, dir: -1}, nil
+}
+
+func (w *boltDriver) Batch() Batch {
+	return &bolt_batch{db: w.db}
+}
+
+func (w *boltDriver) OpenTransaction() (Transaction, error) {
+	tx, err := w.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	return bolt_transaction{tx}, nil
+}
+
+func (w *boltDriver) Dump(prefix []byte, fn func(key, value []byte) error) (err error) {
+	return w.db.View(func(tx *bolt.Tx) (err error) {
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			_, value := splitVersion(v)
+			if err = fn(k, value); err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+func (w *boltDriver) Close() error {
+	boltMutex.Lock()
+	defer boltMutex.Unlock()
+	delete(boltInstances, w.path)
+	return w.db.Close()
+}
+
+func boltGet(b *bolt.Bucket, key []byte) (version string, value []byte, err error) {
+	v := b.Get(key)
+	if v == nil {
+		err = errors.RepoItemNotFound
+		return
+	}
+	version, value = splitVersion(append([]byte{}, v...))
+	return
+}
+
+func boltPut(b *bolt.Bucket, key []byte, prev string, value []byte) (vers string, err error) {
+	v, _, err := boltGet(b, key)
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	vers = version(value)
+	err = b.Put(key, append([]byte(vers), value...))
+	return
+}
+
+func boltDelete(b *bolt.Bucket, key []byte, prev string) (err error) {
+	v, _, err := boltGet(b, key)
+	if err == errors.RepoItemNotFound {
+		return nil
+	}
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	return b.Delete(key)
+}
+
+// bolt_iterator positions a new cursor relative to the current key on every move
+type bolt_iterator struct {
+	db     *bolt.DB
+	prefix []byte
+	key    []byte
+	value  []byte
+	dir    int // -1 before first, 0 at key, 1 after last
+	err    error
+}
+
+func (i *bolt_iterator) move(fn func(c *bolt.Cursor) ([]byte, []byte), dir int) bool {
+	var k, v []byte
+	i.err = i.db.View(func(tx *bolt.Tx) error {
+		k, v = fn(tx.Bucket(boltBucket).Cursor())
+		if k != nil && bytes.HasPrefix(k, i.prefix) {
+			k, v = append([]byte{}, k...), append([]byte{}, v...)
+		} else {
+			k, v = nil, nil
+		}
+		return nil
+	})
+	i.key, i.value = k, v
+	if k == nil {
+		i.dir = dir
+		return false
+	}
+	i.dir = 0
+	return true
+}
+
+func (i *bolt_iterator) Seek(key []byte) bool {
+	if bytes.Compare(key, i.prefix) < 0 {
+		key = i.prefix
+	}
+	return i.move(func(c *bolt.Cursor) ([]byte, []byte) {
+		return c.Seek(key)
+	}, 1)
+}
+func (i *bolt_iterator) Valid() bool {
+	return i.dir == 0 && i.key != nil
+}
+func (i *bolt_iterator) First() bool {
+	return i.move(func(c *bolt.Cursor) ([]byte, []byte) {
+		return c.Seek(i.prefix)
+	}, 1)
+}
+func (i *bolt_iterator) Last() bool {
+	return i.move(func(c *bolt.Cursor) ([]byte, []byte) {
+		if limit := prefixLimit(i.prefix); limit != nil {
+			if k, _ := c.Seek(limit); k != nil {
+				return c.Prev()
+			}
+		}
+		return c.Last()
+	}, -1)
+}
+func (i *bolt_iterator) Prev() bool {
+	switch {
+	case i.dir < 0:
+		return false
+	case i.dir > 0:
+		return i.Last()
+	}
+	var key = i.key
+	return i.move(func(c *bolt.Cursor) ([]byte, []byte) {
+		if k, _ := c.Seek(key); k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}, -1)
+}
+func (i *bolt_iterator) Next() bool {
+	switch {
+	case i.dir > 0:
+		return false
+	case i.dir < 0:
+		return i.First()
+	}
+	var key = i.key
+	return i.move(func(c *bolt.Cursor) ([]byte, []byte) {
+		k, v := c.Seek(key)
+		if bytes.Equal(k, key) {
+			return c.Next()
+		}
+		return k, v
+	}, 1)
+}
+func (i *bolt_iterator) Key() []byte {
+	return i.key
+}
+func (i *bolt_iterator) Value() []byte {
+	return i.value
+}
+func (i *bolt_iterator) Release() {
+	i.key, i.value = nil, nil
+	i.dir = 1
+}
+func (i *bolt_iterator) Error() error {
+	return i.err
+}
+
+// prefixLimit returns the smallest key greater than every key with the prefix or nil if unbounded
+func prefixLimit(prefix []byte) []byte {
+	for n := len(prefix) - 1; n >= 0; n-- {
+		if prefix[n] < 0xff {
+			limit := append([]byte{}, prefix[:n+1]...)
+			limit[n]++
+			return limit
+		}
+	}
+	return nil
+}
+
+type bolt_write struct {
+	key   []byte
+	value []byte
+	del   bool
+}
+
+type bolt_batch struct {
+	db     *bolt.DB
+	writes []bolt_write
+}
+
+func (b *bolt_batch) Put(key, value []byte) {
+	b.writes = append(b.writes, bolt_write{key: key, value: value})
+}
+func (b *bolt_batch) Delete(key []byte) {
+	b.writes = append(b.writes, bolt_write{key: key, del: true})
+}
+func (b *bolt_batch) Write() error {
+	return b.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(boltBucket)
+		for _, w := range b.writes {
+			if w.del {
+				err = bucket.Delete(w.key)
+			} else {
+				err = bucket.Put(w.key, append([]byte(version(w.value)), w.value...))
+			}
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+type bolt_transaction struct {
+	tx *bolt.Tx
+}
+
+func (t bolt_transaction) Get(key []byte) (version string, value []byte, err error) {
+	return boltGet(t.tx.Bucket(boltBucket), key)
+}
+func (t bolt_transaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	return boltPut(t.tx.Bucket(boltBucket), key, prev, value)
+}
+func (t bolt_transaction) Delete(key []byte, prev string) (err error) {
+	return boltDelete(t.tx.Bucket(boltBucket), key, prev)
+}
+func (t bolt_transaction) Commit() error {
+	return t.tx.Commit()
+}
+func (t bolt_transaction) Discard() {
+	t.tx.Rollback()
+}
@@ -0,0 +1,162 @@
+package driver
+
+import (
+	"container/list"
+	"sync"
+)
+
+var cacheDefaultSize = 1024
+
+// NewCache wraps a DB with a read through LRU cache of up to size items.
+// Iterators and ranged reads bypass the cache.
+func NewCache(db DB, size int) DB {
+	if size < 1 {
+		size = cacheDefaultSize
+	}
+	return &cacheDriver{
+		DB:    db,
+		size:  size,
+		items: map[string]*list.Element{},
+		lru:   list.New(),
+	}
+}
+
+// cacheDriver invalidates items after they are written to the underlying DB. The epoch is
+// incremented on every invalidation so that a read racing a write never caches a stale value.
+type cacheDriver struct {
+	DB
+	size  int
+	items map[string]*list.Element
+	lru   *list.List
+	epoch uint64
+	mutex sync.Mutex
+}
+
+type cacheItem struct {
+	key     string
+	version string
+	value   []byte
+}
+
+func (c *cacheDriver) Get(key []byte) (version string, value []byte, err error) {
+	c.mutex.Lock()
+	if e, ok := c.items[string(key)]; ok {
+		c.lru.MoveToFront(e)
+		item := e.Value.(*cacheItem)
+		c.mutex.Unlock()
+		return item.version, append([]byte{}, item.value...), nil
+	}
+	var epoch = c.epoch
+	c.mutex.Unlock()
+	if version, value, err = c.DB.Get(key); err != nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if epoch == c.epoch {
+		c.add(&cacheItem{string(key), version, append([]byte{}, value...)})
+	}
+	return
+}
+
+func (c *cacheDriver) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	defer c.invalidate(key)
+	return c.DB.Put(key, prev, value)
+}
+
+func (c *cacheDriver) Delete(key []byte, prev string) (err error) {
+	defer c.invalidate(key)
+	return c.DB.Delete(key, prev)
+}
+
+func (c *cacheDriver) Has(key []byte) (exists bool, err error) {
+	c.mutex.Lock()
+	_, exists = c.items[string(key)]
+	c.mutex.Unlock()
+	if exists {
+		return
+	}
+	return c.DB.Has(key)
+}
+
+func (c *cacheDriver) PutRanged(id, date string, value []byte) (err error) {
+	defer c.invalidate([]byte(id + "-" + date))
+	return c.DB.PutRanged(id, date, value)
+}
+
+func (c *cacheDriver) Batch() Batch {
+	return &cache_batch{Batch: c.DB.Batch(), c: c}
+}
+
+func (c *cacheDriver) OpenTransaction() (Transaction, error) {
+	tx, err := c.DB.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &cache_transaction{Transaction: tx, c: c}, nil
+}
+
+// add inserts an item evicting the least recently used item if full. Caller must hold mutex.
+func (c *cacheDriver) add(item *cacheItem) {
+	if e, ok := c.items[item.key]; ok {
+		e.Value = item
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.items[item.key] = c.lru.PushFront(item)
+	if c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*cacheItem).key)
+	}
+}
+
+func (c *cacheDriver) invalidate(keys ...[]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.epoch++
+	for _, key := range keys {
+		if e, ok := c.items[string(key)]; ok {
+			c.lru.Remove(e)
+			delete(c.items, string(key))
+		}
+	}
+}
+
+type cache_batch struct {
+	Batch
+	c    *cacheDriver
+	keys [][]byte
+}
+
+func (b *cache_batch) Put(key, value []byte) {
+	b.keys = append(b.keys, key)
+	b.Batch.Put(key, value)
+}
+func (b *cache_batch) Delete(key []byte) {
+	b.keys = append(b.keys, key)
+	b.Batch.Delete(key)
+}
+func (b *cache_batch) Write() error {
+	defer b.c.invalidate(b.keys...)
+	return b.Batch.Write()
+}
+
+type cache_transaction struct {
+	Transaction
+	c    *cacheDriver
+	keys [][]byte
+}
+
+func (t *cache_transaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	t.keys = append(t.keys, key)
+	return t.Transaction.Put(key, prev, value)
+}
+func (t *cache_transaction) Delete(key []byte, prev string) (err error) {
+	t.keys = append(t.keys, key)
+	return t.Transaction.Delete(key, prev)
+}
+func (t *cache_transaction) Commit() error {
+	defer t.c.invalidate(t.keys...)
+	return t.Transaction.Commit()
+}
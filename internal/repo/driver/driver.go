@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"sync"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+)
+
+var (
+	inmemoryInstances = map[*config.InMemoryDB]*inmemoryDriver{}
+	inmemoryMutex     sync.Mutex
+)
+
+// New returns the driver configured for a key value store or nil if none is configured.
+// Stores with a namespace share their database with every other namespace using the same config.
+func New(cfg config.KeyValueStore) (db DB, err error) {
+	if db, err = open(cfg); err == nil && db != nil && len(cfg.Namespace) > 0 {
+		db = NewNamespace(db, cfg.Namespace)
+	}
+	if err != nil || db == nil {
+		return
+	}
+	if cfg.Cache != nil && cfg.Cache.Enabled {
+		db = NewCache(db, cfg.Cache.Size)
+	}
+	return
+}
+
+func open(cfg config.KeyValueStore) (db DB, err error) {
+	if cfg.LevelDB != nil {
+		d, err := NewLevelDB(*cfg.LevelDB)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	if cfg.BoltDB != nil {
+		d, err := NewBoltDB(*cfg.BoltDB)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	if cfg.InMemoryDB != nil {
+		return openInMemory(cfg.InMemoryDB)
+	}
+	return
+}
+
+// openInMemory returns the in memory database for a config. Like LevelDB and BoltDB instances
+// which are shared by path, in memory instances are shared by config.
+func openInMemory(cfg *config.InMemoryDB) (db DB, err error) {
+	inmemoryMutex.Lock()
+	defer inmemoryMutex.Unlock()
+	d, ok := inmemoryInstances[cfg]
+	if !ok {
+		if d, err = NewInMemory(*cfg); err != nil {
+			return
+		}
+		inmemoryInstances[cfg] = d
+	}
+	return d, nil
+}
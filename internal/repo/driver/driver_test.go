@@ -0,0 +1,125 @@
+package driver_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver/drivertest"
+)
+
+func TestLevelDB(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) driver.DB {
+		db, err := driver.NewLevelDB(config.LevelDB{Path: filepath.Join(t.TempDir(), "db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestInMemory(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) driver.DB {
+		db, _ := driver.NewInMemory(config.InMemoryDB{})
+		return db
+	})
+}
+
+func TestBoltDB(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) driver.DB {
+		db, err := driver.NewBoltDB(config.BoltDB{Path: filepath.Join(t.TempDir(), "db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) driver.DB {
+		db, _ := driver.NewInMemory(config.InMemoryDB{})
+		// Neighboring namespaces must not leak into the namespace under test
+		for _, ns := range []string{"a", "b-0001", "c"} {
+			other := driver.NewNamespace(db, ns)
+			for _, k := range []string{"", "a", "k0", "k2", "bk1", "\xff"} {
+				if _, err := other.Put([]byte(k), "", []byte("x")); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return driver.NewNamespace(db, "b")
+	})
+}
+
+func TestCache(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) driver.DB {
+		db, _ := driver.NewInMemory(config.InMemoryDB{})
+		return driver.NewCache(db, 2)
+	})
+}
+
+func TestCacheEviction(t *testing.T) {
+	db, _ := driver.NewInMemory(config.InMemoryDB{})
+	c := driver.NewCache(db, 2)
+	for _, k := range []string{"a", "b", "c"} {
+		_, err := c.Put([]byte(k), "", []byte("1"))
+		require.Nil(t, err)
+		_, _, err = c.Get([]byte(k))
+		require.Nil(t, err)
+	}
+	// Writes bypassing the cache are only visible for evicted items
+	for _, k := range []string{"a", "b", "c"} {
+		_, err := db.Put([]byte(k), "", []byte("2"))
+		require.Nil(t, err)
+	}
+	_, v, err := c.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), v)
+	_, v, err = c.Get([]byte("c"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), v)
+
+	// Writes through the cache invalidate
+	vers, err := c.Put([]byte("c"), "", []byte("3"))
+	require.Nil(t, err)
+	v2, v, err := c.Get([]byte("c"))
+	require.Nil(t, err)
+	require.Equal(t, vers, v2)
+	require.Equal(t, []byte("3"), v)
+
+	b := c.Batch()
+	b.Delete([]byte("c"))
+	require.Nil(t, b.Write())
+	_, _, err = c.Get([]byte("c"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+
+	_, _, err = c.Get([]byte("a"))
+	require.Nil(t, err)
+	tx, err := c.OpenTransaction()
+	require.Nil(t, err)
+	_, err = tx.Put([]byte("a"), "", []byte("4"))
+	require.Nil(t, err)
+	require.Nil(t, tx.Commit())
+	_, v, err = c.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("4"), v)
+}
+
+func TestVerify(t *testing.T) {
+	db, _ := driver.NewInMemory(config.InMemoryDB{})
+	_, err := db.Put([]byte("a"), "", []byte("value"))
+	require.Nil(t, err)
+	iter, err := db.Iterator()
+	require.Nil(t, err)
+	defer iter.Release()
+	require.True(t, iter.Next())
+	var stored = append([]byte{}, iter.Value()...)
+	require.True(t, driver.Verify(stored))
+	stored[len(stored)-1]++
+	require.False(t, driver.Verify(stored))
+	require.False(t, driver.Verify([]byte("short")))
+}
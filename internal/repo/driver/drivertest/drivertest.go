@@ -0,0 +1,343 @@
+// Package drivertest provides a conformance suite for driver.DB implementations
+package drivertest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+)
+
+// Run runs the conformance suite against fresh databases returned by open
+func Run(t *testing.T, open func(t *testing.T) driver.DB) {
+	for _, test := range []struct {
+		name string
+		fn   func(t *testing.T, db driver.DB)
+	}{
+		{"Put", testPut},
+		{"Delete", testDelete},
+		{"Iterator", testIterator},
+		{"PrefixIterator", testPrefixIterator},
+		{"GetRanged", testGetRanged},
+		{"Batch", testBatch},
+		{"Transaction", testTransaction},
+		{"BatchTransaction", testBatchTransaction},
+		{"Dump", testDump},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := open(t)
+			defer db.Close()
+			test.fn(t, db)
+		})
+	}
+}
+
+// fill inserts keys k0 through k(n-1) with values v0 through v(n-1) in reverse order
+func fill(t *testing.T, db driver.DB, prefix string, n int) {
+	for i := n - 1; i >= 0; i-- {
+		_, err := db.Put([]byte(fmt.Sprintf("%sk%d", prefix, i)), "", []byte(fmt.Sprintf("v%d", i)))
+		require.Nil(t, err)
+	}
+}
+
+func testPut(t *testing.T, db driver.DB) {
+	_, _, err := db.Get([]byte("a"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+	exists, err := db.Has([]byte("a"))
+	require.Nil(t, err)
+	require.False(t, exists)
+
+	// Insert with a prev version for a missing item fails
+	_, err = db.Put([]byte("a"), "0123456789abcdef", []byte("1"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+
+	v1, err := db.Put([]byte("a"), "", []byte("1"))
+	require.Nil(t, err)
+	require.Equal(t, 16, len(v1))
+	vers, val, err := db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, v1, vers)
+	require.Equal(t, []byte("1"), val)
+	exists, err = db.Has([]byte("a"))
+	require.Nil(t, err)
+	require.True(t, exists)
+
+	// Returned values are owned by the caller
+	val[0] = 'x'
+	_, val, err = db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), val)
+
+	v2, err := db.Put([]byte("a"), v1, []byte("2"))
+	require.Nil(t, err)
+	require.NotEqual(t, v1, v2)
+
+	// Stale version
+	_, err = db.Put([]byte("a"), v1, []byte("3"))
+	require.Equal(t, errors.RepoItemVersionConflict, err)
+	_, val, err = db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), val)
+
+	// Empty prev overwrites unconditionally
+	v3, err := db.Put([]byte("a"), "", []byte("3"))
+	require.Nil(t, err)
+	vers, val, err = db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, v3, vers)
+	require.Equal(t, []byte("3"), val)
+
+	// Versions are content addressed
+	v4, err := db.Put([]byte("b"), "", []byte("3"))
+	require.Nil(t, err)
+	require.Equal(t, v3, v4)
+}
+
+func testDelete(t *testing.T, db driver.DB) {
+	require.Nil(t, db.Delete([]byte("a"), ""))
+	require.Nil(t, db.Delete([]byte("a"), "0123456789abcdef"))
+
+	v1, err := db.Put([]byte("a"), "", []byte("1"))
+	require.Nil(t, err)
+	_, err = db.Put([]byte("a"), v1, []byte("2"))
+	require.Nil(t, err)
+	require.Equal(t, errors.RepoItemVersionConflict, db.Delete([]byte("a"), v1))
+	_, _, err = db.Get([]byte("a"))
+	require.Nil(t, err)
+
+	vers, _, err := db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Nil(t, db.Delete([]byte("a"), vers))
+	_, _, err = db.Get([]byte("a"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+
+	_, err = db.Put([]byte("b"), "", []byte("1"))
+	require.Nil(t, err)
+	require.Nil(t, db.Delete([]byte("b"), ""))
+	exists, err := db.Has([]byte("b"))
+	require.Nil(t, err)
+	require.False(t, exists)
+}
+
+func keys(t *testing.T, iter driver.Iterator, forward bool) (res []string) {
+	for iter.Valid() {
+		res = append(res, string(iter.Key()))
+		if forward {
+			iter.Next()
+		} else {
+			iter.Prev()
+		}
+	}
+	require.Nil(t, iter.Error())
+	return
+}
+
+func testIterator(t *testing.T, db driver.DB) {
+	iter, err := db.Iterator()
+	require.Nil(t, err)
+	require.False(t, iter.First())
+	require.False(t, iter.Last())
+	require.False(t, iter.Valid())
+	iter.Release()
+
+	fill(t, db, "", 5)
+	iter, err = db.Iterator()
+	require.Nil(t, err)
+	defer iter.Release()
+
+	var all []string
+	for iter.Next() {
+		all = append(all, string(iter.Key()))
+		require.Equal(t, "v"+string(iter.Key())[1:], string(iter.Value()[16:]))
+	}
+	require.Equal(t, []string{"k0", "k1", "k2", "k3", "k4"}, all)
+
+	require.True(t, iter.First())
+	require.Equal(t, "k0", string(iter.Key()))
+	require.Equal(t, []string{"k0", "k1", "k2", "k3", "k4"}, keys(t, iter, true))
+
+	require.True(t, iter.Last())
+	require.Equal(t, "k4", string(iter.Key()))
+	require.Equal(t, []string{"k4", "k3", "k2", "k1", "k0"}, keys(t, iter, false))
+
+	// Seek positions at the first key greater than or equal to the target
+	require.True(t, iter.Seek([]byte("k2")))
+	require.Equal(t, "k2", string(iter.Key()))
+	require.True(t, iter.Seek([]byte("k25")))
+	require.Equal(t, "k3", string(iter.Key()))
+	require.True(t, iter.Prev())
+	require.Equal(t, "k2", string(iter.Key()))
+	require.False(t, iter.Seek([]byte("k5")))
+	require.False(t, iter.Valid())
+}
+
+func testPrefixIterator(t *testing.T, db driver.DB) {
+	fill(t, db, "a", 3)
+	fill(t, db, "b", 3)
+	fill(t, db, "c", 3)
+	iter, err := db.PrefixIterator([]byte("b"))
+	require.Nil(t, err)
+	defer iter.Release()
+
+	require.True(t, iter.First())
+	require.Equal(t, []string{"bk0", "bk1", "bk2"}, keys(t, iter, true))
+	require.True(t, iter.Last())
+	require.Equal(t, []string{"bk2", "bk1", "bk0"}, keys(t, iter, false))
+	require.False(t, iter.Seek([]byte("c")))
+	require.True(t, iter.Seek([]byte("a")))
+	require.Equal(t, "bk0", string(iter.Key()))
+}
+
+func ranged(t *testing.T, db driver.DB, start, end string, limit int, reverse bool) (res []string) {
+	var s, e []byte
+	if len(start) > 0 {
+		s = []byte(start)
+	}
+	if len(end) > 0 {
+		e = []byte(end)
+	}
+	k, v, err := db.GetRanged(s, e, limit, reverse)
+	require.Nil(t, err)
+	require.Equal(t, len(k), len(v))
+	for i := range k {
+		require.Equal(t, "v"+string(k[i])[1:], string(v[i]))
+		res = append(res, string(k[i]))
+	}
+	return
+}
+
+func testGetRanged(t *testing.T, db driver.DB) {
+	fill(t, db, "", 5)
+
+	require.Equal(t, []string{"k0", "k1", "k2", "k3", "k4"}, ranged(t, db, "", "", 0, false))
+	require.Equal(t, []string{"k4", "k3", "k2", "k1", "k0"}, ranged(t, db, "", "", 0, true))
+
+	// Start is inclusive and end is exclusive
+	require.Equal(t, []string{"k2", "k3", "k4"}, ranged(t, db, "k2", "", 0, false))
+	require.Equal(t, []string{"k1", "k2"}, ranged(t, db, "k1", "k3", 0, false))
+	require.Equal(t, []string{"k2", "k1"}, ranged(t, db, "k1", "k3", 0, true))
+	require.Equal(t, []string{"k0", "k1"}, ranged(t, db, "", "k2", 0, false))
+
+	// Limit applies from the end when reversed
+	require.Equal(t, []string{"k1", "k2"}, ranged(t, db, "k1", "", 2, false))
+	require.Equal(t, []string{"k4", "k3"}, ranged(t, db, "k1", "", 2, true))
+	require.Equal(t, []string{"k3", "k2"}, ranged(t, db, "", "k4", 2, true))
+
+	require.Equal(t, 0, len(ranged(t, db, "z", "", 0, false)))
+	require.Equal(t, 0, len(ranged(t, db, "z", "", 0, true)))
+	require.Equal(t, 0, len(ranged(t, db, "k2", "k2", 0, true)))
+}
+
+func testBatch(t *testing.T, db driver.DB) {
+	fill(t, db, "", 3)
+	b := db.Batch()
+	b.Put([]byte("k3"), []byte("v3"))
+	b.Delete([]byte("k0"))
+	b.Put([]byte("k1"), []byte("x"))
+
+	// Nothing is written until Write
+	_, _, err := db.Get([]byte("k3"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+
+	require.Nil(t, b.Write())
+	_, _, err = db.Get([]byte("k0"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+	vers, val, err := db.Get([]byte("k1"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("x"), val)
+	_, err = db.Put([]byte("k1"), vers, []byte("y"))
+	require.Nil(t, err)
+	_, val, err = db.Get([]byte("k3"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("v3"), val)
+}
+
+func testTransaction(t *testing.T, db driver.DB) {
+	checkTransaction(t, db, db.OpenTransaction)
+}
+
+func testBatchTransaction(t *testing.T, db driver.DB) {
+	var mutex sync.Mutex
+	checkTransaction(t, db, func() (driver.Transaction, error) {
+		return driver.NewBatchTransaction(db, &mutex), nil
+	})
+	// The mutex is released by commit and discard
+	mutex.Lock()
+	mutex.Unlock()
+}
+
+// checkTransaction verifies the transactions returned by open
+func checkTransaction(t *testing.T, db driver.DB, open func() (driver.Transaction, error)) {
+	v1, err := db.Put([]byte("a"), "", []byte("1"))
+	require.Nil(t, err)
+
+	// Discarded
+	tx, err := open()
+	require.Nil(t, err)
+	_, err = tx.Put([]byte("a"), v1, []byte("2"))
+	require.Nil(t, err)
+	_, val, err := tx.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), val)
+	tx.Discard()
+	_, val, err = db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), val)
+
+	// Committed
+	tx, err = open()
+	require.Nil(t, err)
+	_, err = tx.Put([]byte("a"), "0123456789abcdef", []byte("2"))
+	require.Equal(t, errors.RepoItemVersionConflict, err)
+	v2, err := tx.Put([]byte("a"), v1, []byte("2"))
+	require.Nil(t, err)
+	_, err = tx.Put([]byte("b"), "", []byte("1"))
+	require.Nil(t, err)
+	require.Nil(t, tx.Delete([]byte("b"), ""))
+	_, err = tx.Put([]byte("c"), "", []byte("1"))
+	require.Nil(t, err)
+	_, _, err = tx.Get([]byte("b"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+	require.Nil(t, tx.Commit())
+	tx.Discard()
+
+	vers, val, err := db.Get([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, v2, vers)
+	require.Equal(t, []byte("2"), val)
+	_, _, err = db.Get([]byte("b"))
+	require.Equal(t, errors.RepoItemNotFound, err)
+	_, _, err = db.Get([]byte("c"))
+	require.Nil(t, err)
+
+	// Writes after discard succeed
+	_, err = db.Put([]byte("a"), v2, []byte("3"))
+	require.Nil(t, err)
+}
+
+func testDump(t *testing.T, db driver.DB) {
+	fill(t, db, "a", 2)
+	fill(t, db, "b", 3)
+	var dump = func(prefix string) (res []string) {
+		require.Nil(t, db.Dump([]byte(prefix), func(key, value []byte) error {
+			res = append(res, string(key)+"="+string(value))
+			return nil
+		}))
+		return
+	}
+	require.Equal(t, []string{"ak0=v0", "ak1=v1", "bk0=v0", "bk1=v1", "bk2=v2"}, dump(""))
+	require.Equal(t, []string{"bk0=v0", "bk1=v1", "bk2=v2"}, dump("b"))
+	require.Equal(t, 0, len(dump("c")))
+
+	var n int
+	err := db.Dump(nil, func(key, value []byte) error {
+		n++
+		return errors.RepoItemVersionConflict
+	})
+	require.Equal(t, errors.RepoItemVersionConflict, err)
+	require.Equal(t, 1, n)
+}
@@ -1,104 +1,217 @@
 package driver
 
 import (
-	"crypto/sha256"
-	"fmt"
 	"sync"
 
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 )
 
 func NewInMemory(cfg config.InMemoryDB) (w *inmemoryDriver, err error) {
-	return &inmemoryDriver{sync.Map{}}, nil
+	return &inmemoryDriver{db: memdb.New(comparer.DefaultComparer, cfg.Size)}, nil
 }
 
+// inmemoryDriver is an ordered in memory driver backed by a skip list.
+// Writes are serialized by mutex so that transactions can block them.
 type inmemoryDriver struct {
-	m sync.Map
+	db    *memdb.DB
+	mutex sync.Mutex
 }
 
 func (d *inmemoryDriver) Get(key []byte) (version string, value []byte, err error) {
-	v, ok := d.m.Load(key)
-	if !ok || v == nil {
+	v, err := d.db.Get(key)
+	if err == memdb.ErrNotFound {
 		err = errors.RepoItemNotFound
 		return
+	} else if err != nil {
+		return
 	}
-	value = v.([]byte)
-	if len(value) > 16 {
-		version = string(value[:16])
-		value = value[16:]
-	}
+	version, value = splitVersion(append([]byte{}, v...))
 	return
 }
 
-func (d *inmemoryDriver) Put(key []byte, prev string, value []byte) (version string, err error) {
-	version = fmt.Sprintf("%x", sha256.Sum256(value))[:16]
+func (d *inmemoryDriver) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	v, _, err := d.Get(key)
-	if err == errors.RepoItemNotFound {
-		if prev != "" {
-			return
-		}
-		err = nil
-	} else if err != nil {
-		return
-	}
-	if prev != "" && v != prev {
-		err = errors.RepoItemVersionConflict
+	if err = checkVersion(v, err, prev); err != nil {
 		return
 	}
-	d.m.Store(string(key), append([]byte(version), value...))
+	vers = version(value)
+	err = d.db.Put(key, append([]byte(vers), value...))
 	return
 }
 
 func (d *inmemoryDriver) Delete(key []byte, prev string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	v, _, err := d.Get(key)
 	if err == errors.RepoItemNotFound {
 		return nil
 	}
-	if err != nil {
-		return
-	}
-	if prev != "" && v != prev {
-		err = errors.RepoItemVersionConflict
+	if err = checkVersion(v, err, prev); err != nil {
 		return
 	}
-	d.m.Delete(key)
-	return
+	return d.db.Delete(key)
 }
 
 func (d *inmemoryDriver) Has(key []byte) (exists bool, err error) {
-	_, exists = d.m.Load(key)
-	return
+	return d.db.Contains(key), nil
 }
 
 func (d *inmemoryDriver) PutRanged(id, date string, value []byte) (err error) {
 	key := id + "-" + date
-	d.m.Store(key, value)
+	d.db.Put([]byte(key), value)
 	return
 }
 
-func (d *inmemoryDriver) GetRanged(start []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
-	startKey := string(start)
-	d.m.Range(func(k, v interface{}) bool {
-		key, ok := k.(string)
-		if !ok {
-			return true
-		}
-		if len(start) == 0 || key > startKey {
-			keys = append(keys, k.([]byte))
-			values = append(values, v.([]byte))
-			if limit > 0 && len(values) >= limit {
-				return false
-			}
+func (d *inmemoryDriver) GetRanged(start, end []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
+	return getRanged(d.db.NewIterator(&util.Range{Start: start, Limit: end}), limit, reverse)
+}
+
+func (d *inmemoryDriver) PrefixIterator(prefix []byte) (Iterator, error) {
+	return inmemory_iterator{leveldb_iterator{d.db.NewIterator(util.BytesPrefix(prefix))}}, nil
+}
+
+func (d *inmemoryDriver) Iterator() (Iterator, error) {
+	return inmemory_iterator{leveldb_iterator{d.db.NewIterator(nil)}}, nil
+}
+
+func (d *inmemoryDriver) Batch() Batch {
+	return &inmemory_batch{d: d}
+}
+
+func (d *inmemoryDriver) OpenTransaction() (Transaction, error) {
+	d.mutex.Lock()
+	return &inmemory_transaction{d: d, writes: map[string][]byte{}}, nil
+}
+
+// Dump blocks writes until complete since memdb has no snapshots
+func (d *inmemoryDriver) Dump(prefix []byte, fn func(key, value []byte) error) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	iter := d.db.NewIterator(util.BytesPrefix(prefix))
+	defer iter.Release()
+	for iter.Next() {
+		_, value := splitVersion(iter.Value())
+		if err = fn(iter.Key(), value); err != nil {
+			return
 		}
-		return true
-	})
-	if reverse {
-		// NOT TODO - support reverse (nobody cares)
 	}
-	return
+	return iter.Error()
 }
 
 func (d *inmemoryDriver) Close() error {
 	return nil
 }
+
+type inmemory_write struct {
+	key   []byte
+	value []byte
+	del   bool
+}
+
+type inmemory_batch struct {
+	d      *inmemoryDriver
+	writes []inmemory_write
+}
+
+func (b *inmemory_batch) Put(key, value []byte) {
+	b.writes = append(b.writes, inmemory_write{key: key, value: value})
+}
+func (b *inmemory_batch) Delete(key []byte) {
+	b.writes = append(b.writes, inmemory_write{key: key, del: true})
+}
+func (b *inmemory_batch) Write() error {
+	b.d.mutex.Lock()
+	defer b.d.mutex.Unlock()
+	for _, w := range b.writes {
+		if w.del {
+			b.d.db.Delete(w.key)
+		} else {
+			b.d.db.Put(w.key, append([]byte(version(w.value)), w.value...))
+		}
+	}
+	return nil
+}
+
+// inmemory_transaction holds the driver mutex until committed or discarded.
+// Pending writes are stored with their version prefix and deletes as nil.
+type inmemory_transaction struct {
+	d      *inmemoryDriver
+	writes map[string][]byte
+	order  []string
+	done   bool
+}
+
+func (t *inmemory_transaction) Get(key []byte) (version string, value []byte, err error) {
+	if v, ok := t.writes[string(key)]; ok {
+		if v == nil {
+			err = errors.RepoItemNotFound
+			return
+		}
+		version, value = splitVersion(v)
+		return
+	}
+	return t.d.Get(key)
+}
+func (t *inmemory_transaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	v, _, err := t.Get(key)
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	vers = version(value)
+	t.set(key, append([]byte(vers), value...))
+	return
+}
+func (t *inmemory_transaction) Delete(key []byte, prev string) (err error) {
+	v, _, err := t.Get(key)
+	if err == errors.RepoItemNotFound {
+		return nil
+	}
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	t.set(key, nil)
+	return
+}
+func (t *inmemory_transaction) set(key, value []byte) {
+	if _, ok := t.writes[string(key)]; !ok {
+		t.order = append(t.order, string(key))
+	}
+	t.writes[string(key)] = value
+}
+func (t *inmemory_transaction) Commit() error {
+	if t.done {
+		return errors.New("Transaction closed")
+	}
+	for _, k := range t.order {
+		if v := t.writes[k]; v == nil {
+			t.d.db.Delete([]byte(k))
+		} else {
+			t.d.db.Put([]byte(k), v)
+		}
+	}
+	t.Discard()
+	return nil
+}
+func (t *inmemory_transaction) Discard() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.d.mutex.Unlock()
+}
+
+// inmemory_iterator copies values since memdb returns slices of its internal buffer
+type inmemory_iterator struct {
+	leveldb_iterator
+}
+
+func (i inmemory_iterator) Value() []byte {
+	return append([]byte{}, i.iter.Value()...)
+}
@@ -1,23 +1,33 @@
 package driver
 
 type DB interface {
-	Get(key []byte) (version string, value []byte, err error)
-	Put(key []byte, prev string, value []byte) (version string, err error)
-	Delete(key []byte, prev string) (err error)
+	ReadWriter
 	Has(key []byte) (exists bool, err error)
 	PutRanged(id, date string, value []byte) (err error)
-	GetRanged(start []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error)
+	// GetRanged returns up to limit items with keys in [start, end) where a nil end is unbounded.
+	// A limit of 0 is unlimited. Items are ordered by key descending when reverse is true.
+	GetRanged(start, end []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error)
 	Iterator() (Iterator, error)
 	PrefixIterator(prefix []byte) (Iterator, error)
+	Batch() Batch
+	OpenTransaction() (Transaction, error)
+	// Dump calls fn with every item having the prefix from a consistent snapshot of the DB.
+	// Writes to the DB from fn may block.
+	Dump(prefix []byte, fn func(key, value []byte) error) error
 	Close() error
 	/*
-		Batch() Batch
 		RangeIterator(start, limit string) Iterator
-		OpenTransaction() (Transaction, error)
 	*/
 
 }
 
+// ReadWriter provides versioned reads and writes to a DB or Transaction
+type ReadWriter interface {
+	Get(key []byte) (version string, value []byte, err error)
+	Put(key []byte, prev string, value []byte) (version string, err error)
+	Delete(key []byte, prev string) (err error)
+}
+
 type Iterator interface {
 	Valid() bool
 	Seek(key []byte) bool
@@ -31,17 +41,17 @@ type Iterator interface {
 	Error() error
 }
 
-/*
+// Batch accumulates unversioned writes applied atomically by Write
 type Batch interface {
-	Put(key, value string)
-	Delete(key string)
+	Put(key, value []byte)
+	Delete(key []byte)
 	Write() error
 }
 
+// Transaction provides atomic versioned reads and writes. Writes to the DB outside the
+// transaction are blocked until it is committed or discarded.
 type Transaction interface {
-	Put(key, value string)
-	Delete(key string)
+	ReadWriter
 	Commit() error
 	Discard()
 }
-*/
@@ -1,62 +1,54 @@
 package driver
 
 import (
-	"crypto/sha256"
-	"fmt"
+	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	leveldbErr "github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 )
 
-var leveldbInstances = map[string]*leveldbDriver{}
+var (
+	leveldbInstances = map[string]*leveldbDriver{}
+	leveldbMutex     sync.Mutex
+)
 
 func NewLevelDB(cfg config.LevelDB) (w *leveldbDriver, err error) {
+	leveldbMutex.Lock()
+	defer leveldbMutex.Unlock()
 	w, ok := leveldbInstances[cfg.Path]
 	if !ok {
 		db, err := leveldb.OpenFile(cfg.Path, nil)
 		if err != nil {
 			return nil, errors.RepoDBUnavailable
 		}
-		w = &leveldbDriver{db}
+		w = &leveldbDriver{db: db, path: cfg.Path}
 		leveldbInstances[cfg.Path] = w
 	}
 	return
 }
 
 type leveldbDriver struct {
-	db *leveldb.DB
+	db   *leveldb.DB
+	path string
 }
 
 func (w *leveldbDriver) Get(key []byte) (version string, value []byte, err error) {
-	value, err = w.db.Get(key, nil)
-	if err == leveldbErr.ErrNotFound {
-		err = errors.RepoItemNotFound
-		return
-	}
-	if err == nil && len(value) > 16 {
-		version = string(value[:16])
-		value = value[16:]
-	}
-	return
+	return leveldbGet(w.db, key)
 }
 
-func (w *leveldbDriver) Put(key []byte, prev string, value []byte) (version string, err error) {
-	version = fmt.Sprintf("%x", sha256.Sum256(value))[:16]
+func (w *leveldbDriver) Put(key []byte, prev string, value []byte) (vers string, err error) {
 	v, _, err := w.Get(key)
-	if prev != "" && err != nil {
+	if err = checkVersion(v, err, prev); err != nil {
 		return
 	}
-	if prev != "" && v != prev {
-		println(v, prev)
-		err = errors.RepoItemVersionConflict
-		return
-	}
-	err = w.db.Put(key, append([]byte(version), value...), nil)
+	vers = version(value)
+	err = w.db.Put(key, append([]byte(vers), value...), nil)
 	return
 }
 
@@ -65,14 +57,10 @@ func (w *leveldbDriver) Delete(key []byte, prev string) (err error) {
 	if err == errors.RepoItemNotFound {
 		return nil
 	}
-	if err != nil {
+	if err = checkVersion(v, err, prev); err != nil {
 		return
 	}
-	if prev != "" && v != prev {
-		err = errors.RepoItemVersionConflict
-		return
-	}
-	err = w.db.Delete([]byte(key), nil)
+	err = w.db.Delete(key, nil)
 	return
 }
 
@@ -87,20 +75,8 @@ func (w *leveldbDriver) PutRanged(id, date string, value []byte) (err error) {
 	return
 }
 
-func (w *leveldbDriver) GetRanged(start []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
-	iter := w.db.NewIterator(&util.Range{start, nil}, nil)
-	defer iter.Release()
-	for iter.First(); iter.Valid(); iter.Next() {
-		keys = append(keys, []byte(string(iter.Key())))
-		values = append(values, []byte(string(iter.Value()[16:])))
-		if limit > 0 && len(values) >= limit {
-			break
-		}
-	}
-	if reverse {
-		// NOT TODO - support reverse (meh)
-	}
-	return
+func (w *leveldbDriver) GetRanged(start, end []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
+	return getRanged(w.db.NewIterator(&util.Range{Start: start, Limit: end}, nil), limit, reverse)
 }
 
 func (w *leveldbDriver) PrefixIterator(prefix []byte) (Iterator, error) {
@@ -111,7 +87,27 @@ func (w *leveldbDriver) Iterator() (Iterator, error) {
 	return leveldb_iterator{w.db.NewIterator(nil, nil)}, nil
 }
 
+func (w *leveldbDriver) Dump(prefix []byte, fn func(key, value []byte) error) (err error) {
+	snap, err := w.db.GetSnapshot()
+	if err != nil {
+		return
+	}
+	defer snap.Release()
+	iter := snap.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		_, value := splitVersion(iter.Value())
+		if err = fn(iter.Key(), value); err != nil {
+			return
+		}
+	}
+	return iter.Error()
+}
+
 func (w *leveldbDriver) Close() error {
+	leveldbMutex.Lock()
+	defer leveldbMutex.Unlock()
+	delete(leveldbInstances, w.path)
 	return w.db.Close()
 }
 
@@ -129,7 +125,7 @@ func (i leveldb_iterator) First() bool {
 	return i.iter.First()
 }
 func (i leveldb_iterator) Last() bool {
-	return i.iter.First()
+	return i.iter.Last()
 }
 func (i leveldb_iterator) Prev() bool {
 	return i.iter.Prev()
@@ -151,32 +147,70 @@ func (i leveldb_iterator) Error() error {
 	return i.iter.Error()
 }
 
-/*
 func (w *leveldbDriver) Batch() Batch {
 	return leveldb_batch{w.db, new(leveldb.Batch)}
 }
-func (w *leveldbDriver) RangeIterator(start, limit string) Iterator {
-	return leveldb_iterator{w.db.NewIterator(&util.Range{Start: []byte(start), Limit: []byte(limit)}, nil)}
-}
+
 func (w *leveldbDriver) OpenTransaction() (Transaction, error) {
 	transaction, err := w.db.OpenTransaction()
 	if err != nil {
-		return leveldb_transaction{}, err
+		return nil, err
 	}
 	return leveldb_transaction{transaction}, nil
 }
 
+// getRanged reads up to limit items from a ranged iterator in ascending or descending key order
+func getRanged(iter iterator.Iterator, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
+	defer iter.Release()
+	var ok, next = iter.First, iter.Next
+	if reverse {
+		ok, next = iter.Last, iter.Prev
+	}
+	for ok(); iter.Valid(); next() {
+		keys = append(keys, []byte(string(iter.Key())))
+		values = append(values, []byte(string(iter.Value()[16:])))
+		if limit > 0 && len(values) >= limit {
+			break
+		}
+	}
+	err = iter.Error()
+	return
+}
+
+/*
+func (w *leveldbDriver) RangeIterator(start, limit string) Iterator {
+	return leveldb_iterator{w.db.NewIterator(&util.Range{Start: []byte(start), Limit: []byte(limit)}, nil)}
+}
+*/
+
+// leveldbReader is implemented by both leveldb.DB and leveldb.Transaction
+type leveldbReader interface {
+	Get(key []byte, ro *opt.ReadOptions) (value []byte, err error)
+}
+
+func leveldbGet(r leveldbReader, key []byte) (version string, value []byte, err error) {
+	value, err = r.Get(key, nil)
+	if err == leveldbErr.ErrNotFound {
+		err = errors.RepoItemNotFound
+		return
+	}
+	if err == nil {
+		version, value = splitVersion(value)
+	}
+	return
+}
+
 type leveldb_batch struct {
 	db    *leveldb.DB
 	batch *leveldb.Batch
 }
 
-func (b leveldb_batch) Put(key string, value []byte) {
-	b.batch.Put([]byte(key), value)
+func (b leveldb_batch) Put(key, value []byte) {
+	b.batch.Put(key, append([]byte(version(value)), value...))
 	return
 }
-func (b leveldb_batch) Delete(key string) {
-	b.batch.Delete([]byte(key))
+func (b leveldb_batch) Delete(key []byte) {
+	b.batch.Delete(key)
 	return
 }
 func (b leveldb_batch) Write() error {
@@ -187,14 +221,28 @@ type leveldb_transaction struct {
 	transaction *leveldb.Transaction
 }
 
-func (t leveldb_transaction) Put(key string, value []byte) {
-	t.transaction.Put([]byte(key), value, nil)
-	return
+func (t leveldb_transaction) Get(key []byte) (version string, value []byte, err error) {
+	return leveldbGet(t.transaction, key)
 }
-func (t leveldb_transaction) Delete(key string) {
-	t.transaction.Delete([]byte(key), nil)
+func (t leveldb_transaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	v, _, err := t.Get(key)
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	vers = version(value)
+	err = t.transaction.Put(key, append([]byte(vers), value...), nil)
 	return
 }
+func (t leveldb_transaction) Delete(key []byte, prev string) (err error) {
+	v, _, err := t.Get(key)
+	if err == errors.RepoItemNotFound {
+		return nil
+	}
+	if err = checkVersion(v, err, prev); err != nil {
+		return
+	}
+	return t.transaction.Delete(key, nil)
+}
 func (t leveldb_transaction) Commit() error {
 	return t.transaction.Commit()
 }
@@ -202,4 +250,3 @@ func (t leveldb_transaction) Discard() {
 	t.transaction.Discard()
 	return
 }
-*/
@@ -0,0 +1,137 @@
+package driver
+
+// namespaceSeparator terminates namespace prefixes so that no namespace prefixes another
+const namespaceSeparator = ':'
+
+// NewNamespace scopes all reads and writes to keys in db beginning with the namespace prefix.
+// Keys are returned without the prefix.
+func NewNamespace(db DB, namespace string) DB {
+	return &namespaceDriver{db, append([]byte(namespace), namespaceSeparator)}
+}
+
+type namespaceDriver struct {
+	db     DB
+	prefix []byte
+}
+
+func (n *namespaceDriver) key(key []byte) []byte {
+	return append(append([]byte{}, n.prefix...), key...)
+}
+
+func (n *namespaceDriver) Get(key []byte) (version string, value []byte, err error) {
+	return n.db.Get(n.key(key))
+}
+
+func (n *namespaceDriver) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	return n.db.Put(n.key(key), prev, value)
+}
+
+func (n *namespaceDriver) Delete(key []byte, prev string) (err error) {
+	return n.db.Delete(n.key(key), prev)
+}
+
+func (n *namespaceDriver) Has(key []byte) (exists bool, err error) {
+	return n.db.Has(n.key(key))
+}
+
+func (n *namespaceDriver) PutRanged(id, date string, value []byte) (err error) {
+	return n.db.PutRanged(string(n.prefix)+id, date, value)
+}
+
+func (n *namespaceDriver) GetRanged(start, end []byte, limit int, reverse bool) (keys [][]byte, values [][]byte, err error) {
+	var limitKey = prefixLimit(n.prefix)
+	if end != nil {
+		limitKey = n.key(end)
+	}
+	keys, values, err = n.db.GetRanged(n.key(start), limitKey, limit, reverse)
+	for i := range keys {
+		keys[i] = keys[i][len(n.prefix):]
+	}
+	return
+}
+
+func (n *namespaceDriver) PrefixIterator(prefix []byte) (Iterator, error) {
+	iter, err := n.db.PrefixIterator(n.key(prefix))
+	if err != nil {
+		return nil, err
+	}
+	return namespace_iterator{iter, n}, nil
+}
+
+func (n *namespaceDriver) Iterator() (Iterator, error) {
+	return n.PrefixIterator(nil)
+}
+
+func (n *namespaceDriver) Batch() Batch {
+	return namespace_batch{n.db.Batch(), n}
+}
+
+func (n *namespaceDriver) OpenTransaction() (Transaction, error) {
+	tx, err := n.db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return namespace_transaction{tx, n}, nil
+}
+
+func (n *namespaceDriver) Dump(prefix []byte, fn func(key, value []byte) error) (err error) {
+	return n.db.Dump(n.key(prefix), func(key, value []byte) error {
+		return fn(key[len(n.prefix):], value)
+	})
+}
+
+// Close does nothing since the database is shared with other namespaces
+func (n *namespaceDriver) Close() error {
+	return nil
+}
+
+type namespace_iterator struct {
+	Iterator
+	n *namespaceDriver
+}
+
+func (i namespace_iterator) Seek(key []byte) bool {
+	return i.Iterator.Seek(i.n.key(key))
+}
+func (i namespace_iterator) Key() []byte {
+	if k := i.Iterator.Key(); len(k) >= len(i.n.prefix) {
+		return k[len(i.n.prefix):]
+	}
+	return nil
+}
+
+type namespace_batch struct {
+	batch Batch
+	n     *namespaceDriver
+}
+
+func (b namespace_batch) Put(key, value []byte) {
+	b.batch.Put(b.n.key(key), value)
+}
+func (b namespace_batch) Delete(key []byte) {
+	b.batch.Delete(b.n.key(key))
+}
+func (b namespace_batch) Write() error {
+	return b.batch.Write()
+}
+
+type namespace_transaction struct {
+	tx Transaction
+	n  *namespaceDriver
+}
+
+func (t namespace_transaction) Get(key []byte) (version string, value []byte, err error) {
+	return t.tx.Get(t.n.key(key))
+}
+func (t namespace_transaction) Put(key []byte, prev string, value []byte) (vers string, err error) {
+	return t.tx.Put(t.n.key(key), prev, value)
+}
+func (t namespace_transaction) Delete(key []byte, prev string) (err error) {
+	return t.tx.Delete(t.n.key(key), prev)
+}
+func (t namespace_transaction) Commit() error {
+	return t.tx.Commit()
+}
+func (t namespace_transaction) Discard() {
+	t.tx.Discard()
+}
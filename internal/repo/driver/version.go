@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+)
+
+// version returns the 16 byte version prefix stored with a value
+func version(value []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(value))[:16]
+}
+
+// splitVersion separates a stored value from its version prefix
+func splitVersion(stored []byte) (version string, value []byte) {
+	if len(stored) >= 16 {
+		return string(stored[:16]), stored[16:]
+	}
+	return "", stored
+}
+
+// checkVersion verifies the current version of an item matches prev before a write
+func checkVersion(current string, err error, prev string) error {
+	if err == errors.RepoItemNotFound {
+		if prev != "" {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if prev != "" && current != prev {
+		return errors.RepoItemVersionConflict
+	}
+	return nil
+}
+
+// Verify reports whether a stored value's version prefix matches the value
+func Verify(stored []byte) bool {
+	v, value := splitVersion(stored)
+	return len(v) > 0 && v == version(value)
+}
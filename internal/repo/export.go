@@ -0,0 +1,368 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nicklaw5/helix"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+// ExportVersion is incremented whenever the export format changes incompatibly
+const ExportVersion = 1
+
+// exportLineMax is the longest line accepted by Import
+const exportLineMax = 16 << 20
+
+// ExportRecord is a single line of a JSON Lines export. The first record is always an
+// ExportHeader of type "header".
+type ExportRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type ExportHeader struct {
+	Version     int    `json:"version"`
+	Created     uint32 `json:"created"`
+	GameVersion uint64 `json:"gameVersion"`
+	Scrubbed    bool   `json:"scrubbed"`
+}
+
+// ExportFrame contains a frame's raw data along with its decoded header fields for readability.
+// Data is authoritative on import.
+type ExportFrame struct {
+	BoardID   uint16 `json:"boardID"`
+	Timestamp uint32 `json:"timestamp"`
+	TileID    uint8  `json:"tileID"`
+	UserID    uint32 `json:"userID"`
+	Deleted   bool   `json:"deleted"`
+	Data      string `json:"data"`
+}
+
+// Export writes every entity as JSON Lines returning the number of records written by type.
+// Personal information is removed from users and faults when scrub is true.
+func Export(cfg config.Repos, w io.Writer, scrub bool) (counts map[string]int, err error) {
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	if rGame == nil {
+		return nil, fmt.Errorf("Game repo not configured")
+	}
+	rBoard, err := NewBoard(cfg.Board)
+	if err != nil {
+		return
+	}
+	rUser, err := NewUser(cfg.User)
+	if err != nil {
+		return
+	}
+	rLove, err := NewLove(cfg.Love)
+	if err != nil {
+		return
+	}
+	rReport, err := NewReport(cfg.Report)
+	if err != nil {
+		return
+	}
+	rUserBan, err := NewUserBan(cfg.UserBan)
+	if err != nil {
+		return
+	}
+	rFault, err := NewFault(cfg.Fault)
+	if err != nil {
+		return
+	}
+
+	counts = map[string]int{}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var write = func(t string, v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		counts[t]++
+		return enc.Encode(ExportRecord{t, b})
+	}
+
+	var header = ExportHeader{
+		Version:  ExportVersion,
+		Created:  uint32(time.Now().Unix()),
+		Scrubbed: scrub,
+	}
+	if header.GameVersion, err = rGame.Version(); err != nil {
+		return
+	}
+	if err = write("header", header); err != nil {
+		return
+	}
+	delete(counts, "header")
+
+	series, err := rGame.AllSeries()
+	if err != nil {
+		return
+	}
+	for _, s := range series {
+		if err = write("series", s); err != nil {
+			return
+		}
+	}
+	if rBoard != nil {
+		for _, s := range series {
+			for _, b := range s.Boards {
+				frames, err := rBoard.All(b.ID)
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range frames {
+					if err = write("frame", ExportFrame{
+						BoardID:   b.ID,
+						Timestamp: f.Timestamp(),
+						TileID:    f.TileID(),
+						UserID:    f.UserID(),
+						Deleted:   f.Deleted(),
+						Data:      hex.EncodeToString(f.Data),
+					}); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	if rUser != nil {
+		users, err := rUser.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			if scrub {
+				scrubUser(u)
+			}
+			if err = write("user", u); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rLove != nil {
+		loves, err := rLove.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range loves {
+			if err = write("love", l); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rReport != nil {
+		reports, err := rReport.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range reports {
+			if err = write("report", r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rUserBan != nil {
+		userBans, err := rUserBan.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range userBans {
+			if err = write("userBan", b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rFault != nil {
+		faults, err := rFault.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range faults {
+			if scrub {
+				f.UserAgent = ""
+			}
+			if err = write("fault", f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = bw.Flush()
+	return
+}
+
+// Import reads a JSON Lines export written by Export preserving all ids.
+// Records for repos that are not configured are skipped.
+func Import(cfg config.Repos, r io.Reader) (counts map[string]int, err error) {
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	rBoard, err := NewBoard(cfg.Board)
+	if err != nil {
+		return
+	}
+	rUser, err := NewUser(cfg.User)
+	if err != nil {
+		return
+	}
+	rLove, err := NewLove(cfg.Love)
+	if err != nil {
+		return
+	}
+	rReport, err := NewReport(cfg.Report)
+	if err != nil {
+		return
+	}
+	rUserBan, err := NewUserBan(cfg.UserBan)
+	if err != nil {
+		return
+	}
+	rFault, err := NewFault(cfg.Fault)
+	if err != nil {
+		return
+	}
+
+	counts = map[string]int{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, exportLineMax)
+	var line int
+	var header *ExportHeader
+	for scanner.Scan() {
+		line++
+		var rec ExportRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return counts, fmt.Errorf("Line %d: %v", line, err)
+		}
+		if header == nil {
+			if rec.Type != "header" {
+				return counts, fmt.Errorf("Line %d: Export header missing", line)
+			}
+			header = &ExportHeader{}
+			if err = json.Unmarshal(rec.Data, header); err != nil {
+				return counts, fmt.Errorf("Line %d: %v", line, err)
+			}
+			if header.Version > ExportVersion {
+				return counts, fmt.Errorf("Unsupported export version %d", header.Version)
+			}
+			continue
+		}
+		var ok bool
+		if ok, err = importRecord(rec, rGame, rBoard, rUser, rLove, rReport, rUserBan, rFault); err != nil {
+			return counts, fmt.Errorf("Line %d: %v", line, err)
+		}
+		if ok {
+			counts[rec.Type]++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if header == nil {
+		err = fmt.Errorf("Export header missing")
+	}
+	return
+}
+
+func importRecord(rec ExportRecord, rGame *game, rBoard *board, rUser *user, rLove *love,
+	rReport *report, rUserBan *userBan, rFault *fault) (ok bool, err error) {
+	switch rec.Type {
+	case "series":
+		s := entity.SeriesFromJson(rec.Data)
+		if s == nil {
+			return false, fmt.Errorf("Invalid series")
+		}
+		if rGame == nil {
+			return
+		}
+		err = rGame.put(s)
+	case "frame":
+		var ef ExportFrame
+		if err = json.Unmarshal(rec.Data, &ef); err != nil {
+			return
+		}
+		var b []byte
+		if b, err = hex.DecodeString(ef.Data); err != nil {
+			return
+		}
+		f := entity.FrameFromBytes(b)
+		if f == nil || len(f.Data) < entity.FrameHeaderSize {
+			return false, fmt.Errorf("Invalid frame")
+		}
+		if f.Timestamp() != ef.Timestamp || f.TileID() != ef.TileID || f.UserID() != ef.UserID || f.Deleted() != ef.Deleted {
+			return false, fmt.Errorf("Frame header mismatch")
+		}
+		if rBoard == nil {
+			return
+		}
+		err = rBoard.Insert(ef.BoardID, f)
+	case "user":
+		u := entity.UserFromJson(rec.Data)
+		if u == nil || u.UserID == 0 {
+			return false, fmt.Errorf("Invalid user")
+		}
+		if rUser == nil {
+			return
+		}
+		err = rUser.put(u)
+	case "love":
+		l := entity.LoveFromJson(rec.Data)
+		if l == nil {
+			return false, fmt.Errorf("Invalid love")
+		}
+		if rLove == nil {
+			return
+		}
+		err = rLove.Insert(l.BoardID, l.Timecode, l.UserID, l.Date)
+	case "report":
+		r := entity.ReportFromJson(rec.Data)
+		if r == nil {
+			return false, fmt.Errorf("Invalid report")
+		}
+		if rReport == nil {
+			return
+		}
+		err = rReport.Insert(r)
+	case "userBan":
+		b := entity.UserBanFromJson(rec.Data)
+		if b == nil || b.ID == 0 {
+			return false, fmt.Errorf("Invalid userBan")
+		}
+		if rUserBan == nil {
+			return
+		}
+		err = rUserBan.put(b)
+	case "fault":
+		f := entity.FaultFromJson(rec.Data)
+		if f == nil {
+			return false, fmt.Errorf("Invalid fault")
+		}
+		if rFault == nil {
+			return
+		}
+		err = rFault.Insert(f.ErrType, f.UserID, f.UserAgent, f.Date)
+	default:
+		return false, fmt.Errorf("Unknown record type %s", rec.Type)
+	}
+	return err == nil, err
+}
+
+// scrubUser replaces a user's twitch identity with placeholders derived from their UserID
+func scrubUser(u *entity.User) {
+	var name = fmt.Sprintf("user%d", u.UserID)
+	u.User = helix.User{
+		ID:          fmt.Sprintf("scrubbed-%d", u.UserID),
+		Login:       name,
+		DisplayName: name,
+	}
+}
@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nicklaw5/helix"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestExport(t *testing.T) {
+	src := testRepos()
+	rGame, _ := NewGame(src.Game)
+	require.Nil(t, rGame.InsertSeries(&entity.Series{Name: "a", Boards: []entity.Board{{ID: 1}}}))
+	rBoard, _ := NewBoard(src.Board)
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(10, 1, 1, map[int]uint8{0: 1})))
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(20, 2, 1, map[int]uint8{0: 1})))
+	require.Nil(t, rBoard.Delete(1, 20*256+2))
+	rUser, _ := NewUser(src.User)
+	_, _, err := rUser.FindOrInsert(&entity.User{User: helix.User{ID: "123", Login: "alice"}})
+	require.Nil(t, err)
+	rLove, _ := NewLove(src.Love)
+	require.Nil(t, rLove.Insert(1, 10*256+1, 1, time.Unix(100, 0)))
+	rReport, _ := NewReport(src.Report)
+	require.Nil(t, rReport.Insert(&entity.Report{TargetID: 1, BoardID: 1, Timecode: 10*256 + 1, UserID: 1, Reason: "x"}))
+	rUserBan, _ := NewUserBan(src.UserBan)
+	require.Nil(t, rUserBan.Insert(&entity.UserBan{TargetID: 1, Reason: "y"}))
+	rFault, _ := NewFault(src.Fault)
+	require.Nil(t, rFault.Insert("storage", 1, "agent", time.Unix(600, 0)))
+
+	var buf bytes.Buffer
+	counts, err := Export(src, &buf, false)
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{
+		"series":  1,
+		"frame":   2,
+		"user":    1,
+		"love":    1,
+		"report":  1,
+		"userBan": 1,
+		"fault":   1,
+	}, counts)
+
+	dst := testRepos()
+	imported, err := Import(dst, bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, counts, imported)
+
+	// Exporting the imported data produces the same records
+	var buf2 bytes.Buffer
+	_, err = Export(dst, &buf2, false)
+	require.Nil(t, err)
+	require.Equal(t, exportLines(t, buf.Bytes())[1:], exportLines(t, buf2.Bytes())[1:])
+
+	// Sequences continue after imported ids
+	rUser, _ = NewUser(dst.User)
+	userID, inserted, err := rUser.FindOrInsert(&entity.User{User: helix.User{ID: "456"}})
+	require.Nil(t, err)
+	require.True(t, inserted)
+	require.Equal(t, uint32(2), userID)
+	rGame, _ = NewGame(dst.Game)
+	s := &entity.Series{}
+	require.Nil(t, rGame.InsertSeries(s))
+	require.Equal(t, uint16(2), s.ID)
+}
+
+func TestExportScrub(t *testing.T) {
+	src := testRepos()
+	rGame, _ := NewGame(src.Game)
+	require.Nil(t, rGame.InsertSeries(&entity.Series{}))
+	rUser, _ := NewUser(src.User)
+	_, _, err := rUser.FindOrInsert(&entity.User{User: helix.User{ID: "123", Login: "alice", Email: "a@b.c"}})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	_, err = Export(src, &buf, true)
+	require.Nil(t, err)
+	require.NotContains(t, buf.String(), "alice")
+	require.NotContains(t, buf.String(), "a@b.c")
+
+	dst := testRepos()
+	_, err = Import(dst, bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	rUser, _ = NewUser(dst.User)
+	u, err := rUser.FindByUserID(1)
+	require.Nil(t, err)
+	require.Equal(t, "user1", u.Login)
+}
+
+func TestImportErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`{"type":"user","data":{}}`,
+		`{"type":"header","data":{"version":99}}`,
+		`{"type":"header","data":{"version":1}}` + "\n" + `{"type":"widget","data":{}}`,
+		`{"type":"header","data":{"version":1}}` + "\n" + `{"type":"frame","data":{"data":"0a00000101000000","timestamp":11}}`,
+	} {
+		_, err := Import(testRepos(), bytes.NewReader([]byte(in)))
+		require.NotNil(t, err, in)
+	}
+}
+
+func exportLines(t *testing.T, b []byte) (lines []ExportRecord) {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var rec ExportRecord
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &rec))
+		lines = append(lines, rec)
+	}
+	return
+}
@@ -17,10 +17,7 @@ type Fault interface {
 
 // NewFault returns a Fault repo instance
 func NewFault(cfg config.KeyValueStore) (r *fault, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -45,18 +42,18 @@ func (r *fault) Insert(errType string, userID uint32, userAgent string, t time.T
 
 // All fetches all faults
 func (r *fault) All() (faults []*entity.Fault, err error) {
-	keys, vals, err := r.db.GetRanged(nil, 0, false)
+	keys, vals, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
 	for i, val := range vals {
-		if len(keys[i]) != 8 {
+		if len(keys[i]) < 8 {
 			continue
 		}
 		faults = append(faults, &entity.Fault{
-			Date:      time.Unix(int64(binary.BigEndian.Uint32(val[0:4])), 0),
+			Date:      time.Unix(int64(binary.BigEndian.Uint32(keys[i][0:4])), 0),
 			UserID:    binary.BigEndian.Uint32(keys[i][4:8]),
-			ErrType:   string(keys[i][6:]),
+			ErrType:   string(keys[i][8:]),
 			UserAgent: string(val),
 		})
 	}
@@ -65,7 +62,7 @@ func (r *fault) All() (faults []*entity.Fault, err error) {
 
 // Sweep deletes all faults older than a given timestamp returning number scanned and number deleted
 func (r *fault) Sweep(t time.Time) (s int, n int, err error) {
-	keys, _, err := r.db.GetRanged([]byte(nil), 0, false)
+	keys, _, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
@@ -21,14 +21,13 @@ type Game interface {
 	UpdateSeries(id string, series *entity.Series) (err error)
 	FindSeries(id string) (res *entity.Series, err error)
 	FindActiveBoard(boardId uint16) (board *entity.Board, err error)
+	FindActiveSeries(boardId uint16) (series *entity.Series, err error)
+	FindSeriesByBoard(boardId uint16) (series *entity.Series, err error)
 }
 
 // NewGame returns an Game repo instance
 func NewGame(cfg config.KeyValueStore) (r *game, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -47,13 +46,13 @@ func (r *game) Version() (v uint64, err error) {
 	if err == errors.RepoItemNotFound {
 		vBytes = make([]byte, 8)
 		rand.Read(vBytes)
-		_, err = r.db.Put([]byte("_v"), "", vBytes)
-		err = nil
+		if _, err = r.db.Put([]byte("_v"), "", vBytes); err != nil {
+			return
+		}
 	} else if err != nil {
 		return
-	} else {
-		v = binary.BigEndian.Uint64(vBytes)
 	}
+	v = binary.BigEndian.Uint64(vBytes)
 
 	return
 }
@@ -94,6 +93,32 @@ func (r *game) AllSeries() (all entity.SeriesList, err error) {
 
 // FindActiveBoard retrieves an active board by id
 func (r *game) FindActiveBoard(boardId uint16) (board *entity.Board, err error) {
+	s, err := r.FindActiveSeries(boardId)
+	if err != nil || s == nil {
+		return
+	}
+	return s.Board(boardId), nil
+}
+
+// FindActiveSeries retrieves the active series containing a board
+func (r *game) FindActiveSeries(boardId uint16) (series *entity.Series, err error) {
+	_, seriesKey, err := r.db.Get(gameBoardKey(boardId))
+	if err == nil {
+		var b []byte
+		if _, b, err = r.db.Get(seriesKey); err == nil {
+			s := entity.SeriesFromJson(b)
+			if s != nil && s.Board(boardId) != nil {
+				if s.Active == 0 || s.Active > uint32(time.Now().Unix()) {
+					return nil, nil
+				}
+				return s, nil
+			}
+		}
+	}
+	if err != nil && err != errors.RepoItemNotFound {
+		return
+	}
+	// Series written before the board index existed
 	iter, err := r.db.PrefixIterator([]byte("series-"))
 	if err != nil {
 		return
@@ -104,11 +129,22 @@ func (r *game) FindActiveBoard(boardId uint16) (board *entity.Board, err error)
 		if s == nil || s.Active == 0 || s.Active > uint32(time.Now().Unix()) {
 			continue
 		}
-		for _, b := range s.Boards {
-			if b.ID == boardId {
-				b.Created = s.Created
-				return &b, nil
-			}
+		if s.Board(boardId) != nil {
+			return s, nil
+		}
+	}
+	return
+}
+
+// FindSeriesByBoard retrieves the series containing a board whether active or not
+func (r *game) FindSeriesByBoard(boardId uint16) (series *entity.Series, err error) {
+	all, err := r.AllSeries()
+	if err != nil {
+		return
+	}
+	for _, s := range all {
+		if s.Board(boardId) != nil {
+			return s, nil
 		}
 	}
 	return
@@ -123,8 +159,13 @@ func (r *game) FindSeries(id string) (res *entity.Series, err error) {
 
 // InsertSeries inserts a new series
 func (r *game) InsertSeries(series *entity.Series) (err error) {
+	tx, err := r.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
 	var id uint16
-	idVers, idBytes, err := r.db.Get([]byte("_id"))
+	idVers, idBytes, err := tx.Get([]byte("_id"))
 	if err == errors.RepoItemNotFound {
 		id = uint16(1)
 	} else if err != nil {
@@ -135,23 +176,75 @@ func (r *game) InsertSeries(series *entity.Series) (err error) {
 	}
 	idBytes = make([]byte, 2)
 	binary.BigEndian.PutUint16(idBytes, id)
-	_, err = r.db.Put([]byte("_id"), idVers, idBytes)
+	_, err = tx.Put([]byte("_id"), idVers, idBytes)
 	if err != nil {
 		return
 	}
 	series.ID = id
-	_, err = r.db.Put([]byte(fmt.Sprintf("series-%04x", id)), "", series.ToJson())
-	return
+	if err = r.putSeries(tx, []byte(fmt.Sprintf("series-%04x", id)), series); err != nil {
+		return
+	}
+	return tx.Commit()
 }
 
 // UpdateSeries updates a new series
 func (r *game) UpdateSeries(id string, series *entity.Series) (err error) {
 	i, _ := strconv.Atoi(id)
 	series.ID = uint16(i)
-	_, err = r.db.Put([]byte("series-"+id), "", series.ToJson())
+	tx, err := r.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
+	if err = r.putSeries(tx, []byte("series-"+id), series); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// put writes a series with its existing ID advancing the id sequence past it if necessary
+func (r *game) put(series *entity.Series) (err error) {
+	tx, err := r.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
+	idVers, idBytes, err := tx.Get([]byte("_id"))
+	if err == errors.RepoItemNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	if len(idBytes) < 2 || binary.BigEndian.Uint16(idBytes) < series.ID {
+		idBytes = make([]byte, 2)
+		binary.BigEndian.PutUint16(idBytes, series.ID)
+		if _, err = tx.Put([]byte("_id"), idVers, idBytes); err != nil {
+			return
+		}
+	}
+	if err = r.putSeries(tx, []byte(fmt.Sprintf("series-%04x", series.ID)), series); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// putSeries writes a series along with the index from each of its boards to the series
+func (r *game) putSeries(rw driver.ReadWriter, key []byte, series *entity.Series) (err error) {
+	if _, err = rw.Put(key, "", series.ToJson()); err != nil {
+		return
+	}
+	for _, b := range series.Boards {
+		if _, err = rw.Put(gameBoardKey(b.ID), "", key); err != nil {
+			return
+		}
+	}
 	return
 }
 
+func gameBoardKey(boardId uint16) []byte {
+	return []byte(fmt.Sprintf("board-%04x", boardId))
+}
+
 // Close closes a database connection
 func (r *game) Close() {
 	r.db.Close()
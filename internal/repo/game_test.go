@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestGameFindActiveSeries(t *testing.T) {
+	r, err := NewGame(config.KeyValueStore{
+		InMemoryDB: &config.InMemoryDB{},
+		Cache:      &config.RepoCache{Enabled: true, Size: 16},
+	})
+	require.Nil(t, err)
+	require.Nil(t, r.InsertSeries(&entity.Series{
+		Active: 1,
+		Boards: []entity.Board{{ID: 1}, {ID: 2}},
+	}))
+	require.Nil(t, r.InsertSeries(&entity.Series{
+		Boards: []entity.Board{{ID: 3}},
+	}))
+
+	s, err := r.FindActiveSeries(2)
+	require.Nil(t, err)
+	require.NotNil(t, s)
+	require.Equal(t, uint16(1), s.ID)
+
+	s, err = r.FindActiveSeries(3)
+	require.Nil(t, err)
+	require.Nil(t, s)
+
+	s, err = r.FindActiveSeries(4)
+	require.Nil(t, err)
+	require.Nil(t, s)
+
+	// Board moved between series
+	require.Nil(t, r.UpdateSeries("0002", &entity.Series{
+		Active: 1,
+		Boards: []entity.Board{{ID: 3}, {ID: 2}},
+	}))
+	s, err = r.FindActiveSeries(3)
+	require.Nil(t, err)
+	require.NotNil(t, s)
+	require.Equal(t, uint16(2), s.ID)
+
+	b, err := r.FindActiveBoard(1)
+	require.Nil(t, err)
+	require.Equal(t, uint16(1), b.ID)
+}
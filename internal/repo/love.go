@@ -17,10 +17,7 @@ type Love interface {
 
 // NewLove returns a Love repo instance
 func NewLove(cfg config.KeyValueStore) (r *love, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -47,7 +44,7 @@ func (r *love) Insert(boardID uint16, timecode, userID uint32, t time.Time) (err
 
 // All fetches all loves
 func (r *love) All() (loves []*entity.Love, err error) {
-	keys, vals, err := r.db.GetRanged(nil, 0, false)
+	keys, vals, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
@@ -57,8 +54,8 @@ func (r *love) All() (loves []*entity.Love, err error) {
 		}
 		loves = append(loves, &entity.Love{
 			BoardID:  binary.BigEndian.Uint16(keys[i][0:2]),
-			Timecode: binary.BigEndian.Uint32(keys[i][2:6]),
-			UserID:   binary.BigEndian.Uint32(keys[i][6:10]),
+			UserID:   binary.BigEndian.Uint32(keys[i][2:6]),
+			Timecode: binary.BigEndian.Uint32(keys[i][6:10]),
 			Date:     time.Unix(int64(binary.BigEndian.Uint32(val[0:4])), 0),
 		})
 	}
@@ -67,7 +64,7 @@ func (r *love) All() (loves []*entity.Love, err error) {
 
 // Sweep deletes all loves older than a given timestamp returning number scanned and number deleted
 func (r *love) Sweep(t time.Time) (s int, n int, err error) {
-	keys, vals, err := r.db.GetRanged([]byte(nil), 0, false)
+	keys, vals, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,378 @@
+package repo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+)
+
+// migrationKey holds the version of the last migration applied to the game DB
+const migrationKey = "_migration"
+
+// migration is a change to stored records. Migrations run once each in version order and
+// should be safe to rerun since a crash may occur before the version is recorded.
+type migration struct {
+	version uint32
+	name    string
+	fn      func(cfg config.Repos) error
+}
+
+// migrations must be appended in ascending version order and never reordered or removed
+var migrations = []migration{
+	{1, "index series boards", migrateSeriesBoardIndex},
+	{2, "index tile locks by user and board", migrateTileLockUserIndex},
+	{3, "index tile lock regions", migrateTileLockRegionIndex},
+	{4, "attribute board snapshot tiles", migrateBoardSnapshotUsers},
+	{5, "import legacy tile lock databases", migrateLegacyTileLocks},
+}
+
+// Migrate applies pending migrations in order followed by any series files in dir not yet
+// present in the game repo. Returns the names of the migrations and files applied.
+func Migrate(cfg config.Repos, dir string) (applied []string, err error) {
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	if rGame == nil {
+		return nil, fmt.Errorf("Game repo not configured")
+	}
+	vers, v, err := rGame.migrationVersion()
+	if err != nil {
+		return
+	}
+	for _, m := range migrations {
+		if m.version <= v {
+			continue
+		}
+		if err = m.fn(cfg); err != nil {
+			return applied, fmt.Errorf("Migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		if vers, err = rGame.setMigrationVersion(vers, m.version); err != nil {
+			return
+		}
+		applied = append(applied, fmt.Sprintf("%04d %s", m.version, m.name))
+	}
+	if len(dir) == 0 {
+		return
+	}
+	files, err := importSeriesFiles(rGame, dir)
+	applied = append(applied, files...)
+	return
+}
+
+// migrationVersion retrieves the last applied migration version
+func (r *game) migrationVersion() (vers string, v uint32, err error) {
+	vers, b, err := r.db.Get([]byte(migrationKey))
+	if err == errors.RepoItemNotFound {
+		return "", 0, nil
+	} else if err != nil {
+		return
+	}
+	if len(b) != 4 {
+		return vers, 0, fmt.Errorf("Invalid migration version")
+	}
+	v = binary.BigEndian.Uint32(b)
+	return
+}
+
+// setMigrationVersion records a migration as applied. Fails with a version conflict if
+// another process has applied a migration since prev was read.
+func (r *game) setMigrationVersion(prev string, v uint32) (vers string, err error) {
+	var b = make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return r.db.Put([]byte(migrationKey), prev, b)
+}
+
+// importSeriesFiles inserts each series_*.json file in dir in name order unless one of its
+// boards already belongs to a series, which is the case once a file has been imported or
+// posted through /debug.
+func importSeriesFiles(rGame *game, dir string) (imported []string, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "series_*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return imported, err
+		}
+		series := entity.SeriesFromJson(b)
+		if series == nil || len(series.Boards) == 0 {
+			return imported, fmt.Errorf("Invalid series file %s", path)
+		}
+		var exists bool
+		for _, board := range series.Boards {
+			s, err := rGame.FindSeriesByBoard(board.ID)
+			if err != nil {
+				return imported, err
+			}
+			if s != nil {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		series.ID = 0
+		if err = rGame.InsertSeries(series); err != nil {
+			return imported, err
+		}
+		imported = append(imported, filepath.Base(path))
+	}
+	return
+}
+
+// migrateSeriesBoardIndex rewrites every series so that series stored before the board index
+// existed are found without a scan
+func migrateSeriesBoardIndex(cfg config.Repos) (err error) {
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	iter, err := rGame.db.PrefixIterator([]byte("series-"))
+	if err != nil {
+		return
+	}
+	var keys [][]byte
+	var all []*entity.Series
+	for iter.Next() {
+		s := entity.SeriesFromJson(iter.Value()[16:])
+		if s == nil {
+			continue
+		}
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		all = append(all, s)
+	}
+	iter.Release()
+	if len(keys) == 0 {
+		return
+	}
+	tx, err := rGame.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
+	for i, s := range all {
+		if err = rGame.putSeries(tx, keys[i], s); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateTileLockUserIndex replaces the tile lock user index keyed by user alone with one keyed
+// by user and board
+func migrateTileLockUserIndex(cfg config.Repos) (err error) {
+	r, err := NewTileLock(cfg.TileLock)
+	if err != nil || r == nil {
+		return
+	}
+	iter, err := r.db.PrefixIterator(tileLockTilePrefix)
+	if err != nil {
+		return
+	}
+	var locks []*entity.TileLock
+	for iter.Next() {
+		if l := tileLockFromKV(iter.Key(), iter.Value()[16:]); l != nil {
+			locks = append(locks, l)
+		}
+	}
+	err = iter.Error()
+	iter.Release()
+	if err != nil {
+		return
+	}
+	iter, err = r.db.PrefixIterator(tileLockUserPrefix)
+	if err != nil {
+		return
+	}
+	var legacy [][]byte
+	for iter.Next() {
+		if len(iter.Key()) == 5 {
+			legacy = append(legacy, append([]byte{}, iter.Key()...))
+		}
+	}
+	err = iter.Error()
+	iter.Release()
+	if err != nil {
+		return
+	}
+	tx, err := r.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
+	for _, key := range legacy {
+		if err = tx.Delete(key, ""); err != nil {
+			return
+		}
+	}
+	for _, l := range locks {
+		if _, err = tx.Put(tileLockUserKey(l.UserID, l.BoardID), "", tileLockTileKey(l.BoardID, l.TileID)); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateTileLockRegionIndex rewrites tile lock user entries referring to a tile key to hold the
+// value of the lock on that tile. Entries whose tile is no longer locked by the user are deleted.
+func migrateTileLockRegionIndex(cfg config.Repos) (err error) {
+	r, err := NewTileLock(cfg.TileLock)
+	if err != nil || r == nil {
+		return
+	}
+	iter, err := r.db.PrefixIterator(tileLockUserPrefix)
+	if err != nil {
+		return
+	}
+	var keys, tiles [][]byte
+	for iter.Next() {
+		if len(iter.Key()) == 7 && len(iter.Value()[16:]) == 5 {
+			keys = append(keys, append([]byte{}, iter.Key()...))
+			tiles = append(tiles, append([]byte{}, iter.Value()[16:]...))
+		}
+	}
+	err = iter.Error()
+	iter.Release()
+	if err != nil || len(keys) == 0 {
+		return
+	}
+	tx, err := r.db.OpenTransaction()
+	if err != nil {
+		return
+	}
+	defer tx.Discard()
+	for i, key := range keys {
+		l, err := tileLockGet(tx, tiles[i])
+		if err != nil {
+			return err
+		}
+		if l == nil || l.UserID != binary.BigEndian.Uint32(key[1:5]) {
+			err = tx.Delete(key, "")
+		} else {
+			_, err = tx.Put(key, "", tileLockValue(l))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateBoardSnapshotUsers deletes board snapshots stored before composite tiles kept the user of
+// the tile's last frame. Snapshots are rebuilt from frames by the snapshot job.
+func migrateBoardSnapshotUsers(cfg config.Repos) (err error) {
+	rGame, err := NewGame(cfg.Game)
+	if err != nil {
+		return
+	}
+	rBoard, err := NewBoard(cfg.Board)
+	if err != nil || rBoard == nil {
+		return
+	}
+	all, err := rGame.AllSeries()
+	if err != nil {
+		return
+	}
+	for _, s := range all {
+		for _, b := range s.Boards {
+			db, err := rBoard.db(b.ID)
+			if err != nil {
+				return err
+			}
+			if err = db.Delete(boardSnapshotKey, ""); err != nil && err != errors.RepoItemNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateLegacyTileLocks imports the unexpired locks of the separate tile and user databases used
+// before tile locks were stored in one database, then deletes the legacy databases. Legacy locks
+// cover one tile. Tiles and users locked since are left as they are.
+func migrateLegacyTileLocks(cfg config.Repos) (err error) {
+	if cfg.TileLock.LevelDB == nil {
+		return
+	}
+	var tilePath = cfg.TileLock.LevelDB.Path + "-tile"
+	var userPath = cfg.TileLock.LevelDB.Path + "-user"
+	if _, err = os.Stat(tilePath); err == nil {
+		if err = importLegacyTileLocks(cfg, tilePath); err != nil {
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	for _, path := range []string{tilePath, userPath} {
+		if err = os.RemoveAll(path); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func importLegacyTileLocks(cfg config.Repos, path string) (err error) {
+	r, err := NewTileLock(cfg.TileLock)
+	if err != nil || r == nil {
+		return
+	}
+	legacy, err := driver.NewLevelDB(config.LevelDB{Path: path})
+	if err != nil {
+		return
+	}
+	var now = time.Now()
+	var locks []*entity.TileLock
+	err = legacy.Dump(nil, func(key, value []byte) error {
+		if len(key) != 4 {
+			return nil
+		}
+		l := tileLockFromValue(binary.BigEndian.Uint16(key[0:2]), binary.BigEndian.Uint16(key[2:4]), value)
+		if l != nil && len(value) == 8 && !l.Expired(now) {
+			locks = append(locks, l)
+		}
+		return nil
+	})
+	if closeErr := legacy.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	for _, l := range locks {
+		var tileKey = tileLockTileKey(l.BoardID, l.TileID)
+		current, err := tileLockGet(tx, tileKey)
+		if err != nil {
+			return err
+		}
+		held, err := userTileLock(tx, l.UserID, l.BoardID)
+		if err != nil {
+			return err
+		}
+		if current != nil || held != nil {
+			continue
+		}
+		var val = tileLockValue(l)
+		if _, err = tx.Put(tileKey, "", val); err != nil {
+			return err
+		}
+		if _, err = tx.Put(tileLockUserKey(l.UserID, l.BoardID), "", val); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
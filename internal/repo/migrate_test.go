@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
+)
+
+func TestMigrate(t *testing.T) {
+	cfg := testRepos()
+	rGame, _ := NewGame(cfg.Game)
+
+	// Series written before the board index existed
+	require.Nil(t, rGame.InsertSeries(&entity.Series{Active: 1, Boards: []entity.Board{{ID: 1}}}))
+	require.Nil(t, rGame.db.Delete(gameBoardKey(1), ""))
+
+	dir, err := ioutil.TempDir("", "migrate")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	// Tile lock indexed by user alone
+	rTileLock, _ := NewTileLock(cfg.TileLock)
+	var lockValue = tileLockValue(&entity.TileLock{UserID: 4, Expires: uint32(time.Now().Add(tileLockTimeout).Unix())})
+	_, err = rTileLock.db.Put(tileLockTileKey(1, 5), "", lockValue[:8])
+	require.Nil(t, err)
+	_, err = rTileLock.db.Put(tileLockUserKey(4, 0)[:5], "", tileLockTileKey(1, 5))
+	require.Nil(t, err)
+	// Snapshot with unattributed tiles
+	rBoard, _ := NewBoard(cfg.Board)
+	require.Nil(t, rBoard.Insert(1, entity.NewFrame(10, 1, 7, map[int]uint8{0: 1})))
+	_, err = rBoard.UpdateSnapshot(1)
+	require.Nil(t, err)
+	for name, s := range map[string]*entity.Series{
+		"series_01.json": {Boards: []entity.Board{{ID: 1}}},
+		"series_02.json": {Name: "b", Boards: []entity.Board{{ID: 2}, {ID: 3}}},
+	} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), s.ToJson(), 0644))
+	}
+
+	applied, err := Migrate(cfg, dir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"0001 index series boards", "0002 index tile locks by user and board", "0003 index tile lock regions", "0004 attribute board snapshot tiles", "0005 import legacy tile lock databases", "series_02.json"}, applied)
+
+	_, v, err := rGame.migrationVersion()
+	require.Nil(t, err)
+	require.Equal(t, migrations[len(migrations)-1].version, v)
+	_, seriesKey, err := rGame.db.Get(gameBoardKey(1))
+	require.Nil(t, err)
+	require.Equal(t, "series-0001", string(seriesKey))
+
+	snapshot, err := rBoard.Snapshot(1)
+	require.Nil(t, err)
+	require.Nil(t, snapshot)
+
+	_, userValue, err := rTileLock.db.Get(tileLockUserKey(4, 1))
+	require.Nil(t, err)
+	l := tileLockFromValue(1, 0, userValue)
+	require.NotNil(t, l)
+	require.Equal(t, []uint16{5}, l.Region())
+	exists, err := rTileLock.db.Has(tileLockUserKey(4, 0)[:5])
+	require.Nil(t, err)
+	require.False(t, exists)
+
+	s, err := rGame.FindSeriesByBoard(3)
+	require.Nil(t, err)
+	require.NotNil(t, s)
+	require.Equal(t, "b", s.Name)
+	require.Equal(t, uint16(2), s.ID)
+
+	applied, err = Migrate(cfg, dir)
+	require.Nil(t, err)
+	require.Len(t, applied, 0)
+	all, err := rGame.AllSeries()
+	require.Nil(t, err)
+	require.Len(t, all, 2)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "series_03.json"), []byte("{"), 0644))
+	_, err = Migrate(cfg, dir)
+	require.NotNil(t, err)
+}
+
+func TestMigrateTileLockRegionIndex(t *testing.T) {
+	cfg := testRepos()
+	rTileLock, _ := NewTileLock(cfg.TileLock)
+	var l = &entity.TileLock{BoardID: 1, TileID: 5, Width: 1, Height: 1, UserID: 4, Expires: uint32(time.Now().Add(tileLockTimeout).Unix())}
+	// User entries written by migration 2 refer to the locked tile
+	_, err := rTileLock.db.Put(tileLockTileKey(1, 5), "", tileLockValue(l)[:8])
+	require.Nil(t, err)
+	_, err = rTileLock.db.Put(tileLockUserKey(4, 1), "", tileLockTileKey(1, 5))
+	require.Nil(t, err)
+	_, err = rTileLock.db.Put(tileLockUserKey(6, 1), "", tileLockTileKey(1, 5))
+	require.Nil(t, err)
+
+	require.Nil(t, migrateTileLockRegionIndex(cfg))
+	_, userValue, err := rTileLock.db.Get(tileLockUserKey(4, 1))
+	require.Nil(t, err)
+	require.Equal(t, tileLockValue(l), userValue)
+	_, _, err = rTileLock.db.Get(tileLockUserKey(6, 1))
+	require.NotNil(t, err)
+	released, err := rTileLock.ReleaseUser(4, time.Now())
+	require.Nil(t, err)
+	require.Len(t, released, 1)
+	require.Equal(t, []uint16{5}, released[0].Tiles)
+}
+
+func TestMigrateLegacyTileLocks(t *testing.T) {
+	cfg := testRepos()
+	var path = filepath.Join(t.TempDir(), "tileLock")
+	cfg.TileLock = config.KeyValueStore{LevelDB: &config.LevelDB{Path: path}}
+	var now = time.Now()
+
+	// Tile and user databases keyed by board and tile and by user
+	legacy, err := driver.NewLevelDB(config.LevelDB{Path: path + "-tile"})
+	require.Nil(t, err)
+	for _, l := range []*entity.TileLock{
+		{BoardID: 1, TileID: 5, UserID: 4, Expires: uint32(now.Add(time.Minute).Unix())},
+		{BoardID: 1, TileID: 6, UserID: 5, Expires: uint32(now.Add(-time.Minute).Unix())},
+		{BoardID: 1, TileID: 7, UserID: 6, Expires: uint32(now.Add(time.Minute).Unix())},
+	} {
+		var key = make([]byte, 4)
+		binary.BigEndian.PutUint16(key[0:2], l.BoardID)
+		binary.BigEndian.PutUint16(key[2:4], l.TileID)
+		_, err = legacy.Put(key, "", tileLockValue(l)[:8])
+		require.Nil(t, err)
+	}
+	require.Nil(t, legacy.Close())
+	require.Nil(t, os.MkdirAll(path+"-user", 0755))
+
+	// Tiles locked since are kept
+	rTileLock, err := NewTileLock(cfg.TileLock)
+	require.Nil(t, err)
+	defer rTileLock.Close()
+	_, err = rTileLock.Acquire(8, 1, 7, 1, 1, now)
+	require.Nil(t, err)
+
+	require.Nil(t, migrateLegacyTileLocks(cfg))
+	locks, err := rTileLock.Board(1, now)
+	require.Nil(t, err)
+	require.Len(t, locks, 2)
+	require.Equal(t, uint32(4), locks[0].UserID)
+	require.Equal(t, []uint16{5}, locks[0].Tiles)
+	require.Equal(t, uint32(8), locks[1].UserID)
+	for _, p := range []string{path + "-tile", path + "-user"} {
+		_, err = os.Stat(p)
+		require.True(t, os.IsNotExist(err))
+	}
+	released, err := rTileLock.ReleaseUser(4, now)
+	require.Nil(t, err)
+	require.Len(t, released, 1)
+
+	// Rerunning is harmless
+	require.Nil(t, migrateLegacyTileLocks(cfg))
+}
@@ -2,26 +2,27 @@ package repo
 
 import (
 	"encoding/binary"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
 )
 
 type Report interface {
 	Insert(report *entity.Report) (err error)
 	All() (reports []*entity.Report, err error)
+	Since(id uint32) (reports []*entity.Report, err error)
 	Sweep(t time.Time) (s int, n int, err error)
 	Clear(targetID uint32) (deleted map[uint16][]uint32, err error)
 }
 
 // NewReport returns a Report repo instance
 func NewReport(cfg config.KeyValueStore) (r *report, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -31,47 +32,86 @@ func NewReport(cfg config.KeyValueStore) (r *report, err error) {
 }
 
 type report struct {
-	db driver.DB
+	db    driver.DB
+	mutex sync.Mutex // Held by batch transactions
 }
 
-// Insert inserts a report
+// Insert inserts a report assigning it the next report ID. Reports are keyed by target, board,
+// timecode and user, so reporting a frame again replaces the report under a new ID.
 func (r *report) Insert(report *entity.Report) (err error) {
-	idBytes := make([]byte, 14)
-	binary.BigEndian.PutUint32(idBytes[0:4], report.TargetID)
-	binary.BigEndian.PutUint16(idBytes[4:6], report.BoardID)
-	binary.BigEndian.PutUint32(idBytes[6:10], report.Timecode)
-	binary.BigEndian.PutUint32(idBytes[10:14], report.UserID)
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	var id uint32
+	idVers, idBytes, err := tx.Get([]byte("_id"))
+	if err == errors.RepoItemNotFound {
+		id = uint32(1)
+	} else if err != nil {
+		return
+	} else {
+		id = binary.BigEndian.Uint32(idBytes)
+		id++
+	}
+	idBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(idBytes, id)
+
+	report.ID = id
+
+	key := reportKey(report)
 	val := make([]byte, 8)
 	binary.BigEndian.PutUint32(val[0:4], report.Date)
 	binary.BigEndian.PutUint32(val[4:8], report.FrameDate)
-	_, err = r.db.Put(idBytes, "", append(val, []byte(report.Reason)...))
-	return
+	if _, err = tx.Put(key, "", append(val, []byte(report.Reason)...)); err != nil {
+		return
+	}
+	if _, err = tx.Put(reportIndexKey(id), "", key); err != nil {
+		return
+	}
+	if _, err = tx.Put([]byte("_id"), idVers, idBytes); err != nil {
+		return
+	}
+	return tx.Commit()
 }
 
 // All fetches all reports
 func (r *report) All() (reports []*entity.Report, err error) {
-	keys, vals, err := r.db.GetRanged(nil, 0, false)
+	return r.Since(0)
+}
+
+// Since fetches the reports with an ID greater than id in ID order. Reports inserted before
+// reports were given IDs have ID 0 and are only returned when id is 0.
+func (r *report) Since(id uint32) (reports []*entity.Report, err error) {
+	keys, vals, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
+	var ids = r.ids(keys, vals)
 	for i, val := range vals {
 		if len(keys[i]) != 14 {
 			continue
 		}
-		reports = append(reports, &entity.Report{
-			TargetID:  binary.BigEndian.Uint32(keys[i][0:4]),
-			BoardID:   binary.BigEndian.Uint16(keys[i][4:6]),
-			Timecode:  binary.BigEndian.Uint32(keys[i][6:10]),
-			UserID:    binary.BigEndian.Uint32(keys[i][10:14]),
-			Date:      binary.BigEndian.Uint32(val[0:4]),
-			FrameDate: binary.BigEndian.Uint32(val[4:8]),
-			Reason:    string(val[8:]),
-		})
+		report := reportFromKeyValue(keys[i], val)
+		report.ID = ids[string(keys[i])]
+		if report.ID > id || id == 0 {
+			reports = append(reports, report)
+		}
 	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
 	return
 }
 
-// Clear
+// ids maps report keys to their latest report ID from the index entries among keys
+func (r *report) ids(keys, vals [][]byte) (ids map[string]uint32) {
+	ids = map[string]uint32{}
+	for i, key := range keys {
+		if len(key) != 5 || key[0] != 'i' {
+			continue
+		}
+		ids[string(vals[i])] = binary.BigEndian.Uint32(key[1:5])
+	}
+	return
+}
+
+// Clear deletes all reports against a user returning the reported timecodes by board
 func (r *report) Clear(targetID uint32) (deleted map[uint16][]uint32, err error) {
 	deleted = map[uint16][]uint32{}
 	idBytes := make([]byte, 4)
@@ -81,24 +121,32 @@ func (r *report) Clear(targetID uint32) (deleted map[uint16][]uint32, err error)
 		return
 	}
 	defer iter.Release()
+	batch := r.db.Batch()
 	for iter.Next() {
+		if len(iter.Key()) != 14 {
+			continue
+		}
 		boardId := binary.BigEndian.Uint16(iter.Key()[4:6])
 		timecode := binary.BigEndian.Uint32(iter.Key()[6:10])
 		deleted[boardId] = append(deleted[boardId], timecode)
-		err = r.db.Delete([]byte(iter.Key()), "")
-		if err != nil {
-			break
-		}
+		batch.Delete([]byte(string(iter.Key())))
+	}
+	if err = iter.Error(); err != nil {
+		return
 	}
+	err = batch.Write()
 	return
 }
 
-// Sweep deletes all reports older than a given timestamp returning number scanned and number deleted
+// Sweep deletes all reports older than a given timestamp returning number scanned and number deleted.
+// Index entries of deleted or replaced reports are deleted as well.
 func (r *report) Sweep(t time.Time) (s int, n int, err error) {
-	keys, vals, err := r.db.GetRanged([]byte(nil), 0, false)
+	keys, vals, err := r.db.GetRanged(nil, nil, 0, false)
 	if err != nil {
 		return
 	}
+	var ids = r.ids(keys, vals)
+	var remaining = map[string]bool{}
 	for i, val := range vals {
 		if len(keys[i]) != 14 {
 			continue
@@ -108,12 +156,55 @@ func (r *report) Sweep(t time.Time) (s int, n int, err error) {
 				return
 			}
 			n++
+		} else {
+			remaining[string(keys[i])] = true
 		}
 		s++
 	}
+	for i, key := range keys {
+		if len(key) != 5 || key[0] != 'i' {
+			continue
+		}
+		id := binary.BigEndian.Uint32(key[1:5])
+		if ids[string(vals[i])] == id && remaining[string(vals[i])] {
+			continue
+		}
+		if err = r.db.Delete(key, ""); err != nil {
+			return
+		}
+	}
 	return
 }
 
+func reportKey(report *entity.Report) []byte {
+	key := make([]byte, 14)
+	binary.BigEndian.PutUint32(key[0:4], report.TargetID)
+	binary.BigEndian.PutUint16(key[4:6], report.BoardID)
+	binary.BigEndian.PutUint32(key[6:10], report.Timecode)
+	binary.BigEndian.PutUint32(key[10:14], report.UserID)
+	return key
+}
+
+// reportIndexKey returns the key of the index entry mapping a report ID to its report key
+func reportIndexKey(id uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = 'i'
+	binary.BigEndian.PutUint32(key[1:5], id)
+	return key
+}
+
+func reportFromKeyValue(key, val []byte) *entity.Report {
+	return &entity.Report{
+		TargetID:  binary.BigEndian.Uint32(key[0:4]),
+		BoardID:   binary.BigEndian.Uint16(key[4:6]),
+		Timecode:  binary.BigEndian.Uint32(key[6:10]),
+		UserID:    binary.BigEndian.Uint32(key[10:14]),
+		Date:      binary.BigEndian.Uint32(val[0:4]),
+		FrameDate: binary.BigEndian.Uint32(val[4:8]),
+		Reason:    string(val[8:]),
+	}
+}
+
 // Close closes a database connection
 func (r *report) Close() {
 	r.db.Close()
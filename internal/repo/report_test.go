@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestReport(t *testing.T) {
+	r, err := NewReport(testInMemory())
+	require.Nil(t, err)
+	var now = uint32(time.Now().Unix())
+	for i, rep := range []*entity.Report{
+		{TargetID: 2, BoardID: 1, Timecode: 10, UserID: 1, Date: now - 3600, Reason: "a"},
+		{TargetID: 1, BoardID: 1, Timecode: 11, UserID: 1, Date: now, Reason: "b"},
+		{TargetID: 3, BoardID: 1, Timecode: 12, UserID: 1, Date: now, Reason: "c"},
+		// Reporting a frame again replaces the report under a new ID
+		{TargetID: 1, BoardID: 1, Timecode: 11, UserID: 1, Date: now, Reason: "d"},
+	} {
+		require.Nil(t, r.Insert(rep))
+		require.Equal(t, uint32(i+1), rep.ID)
+	}
+
+	all, err := r.All()
+	require.Nil(t, err)
+	require.Len(t, all, 3)
+	reports, err := r.Since(1)
+	require.Nil(t, err)
+	require.Len(t, reports, 2)
+	require.Equal(t, uint32(3), reports[0].ID)
+	require.Equal(t, uint32(4), reports[1].ID)
+	require.Equal(t, "d", reports[1].Reason)
+
+	deleted, err := r.Clear(3)
+	require.Nil(t, err)
+	require.Equal(t, map[uint16][]uint32{1: {12}}, deleted)
+	reports, err = r.Since(1)
+	require.Nil(t, err)
+	require.Len(t, reports, 1)
+
+	// Sweep deletes old reports and the index entries of deleted or replaced reports
+	s, n, err := r.Sweep(time.Unix(int64(now-60), 0))
+	require.Nil(t, err)
+	require.Equal(t, 2, s)
+	require.Equal(t, 1, n)
+	keys, _, err := r.db.GetRanged(nil, nil, 0, false)
+	require.Nil(t, err)
+	require.Len(t, keys, 3)
+	all, err = r.All()
+	require.Nil(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, uint32(4), all[0].ID)
+
+	// IDs continue after sweeping
+	rep := &entity.Report{TargetID: 2, BoardID: 1, Timecode: 13, UserID: 1, Date: now}
+	require.Nil(t, r.Insert(rep))
+	require.Equal(t, uint32(5), rep.ID)
+}
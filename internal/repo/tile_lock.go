@@ -3,9 +3,11 @@ package repo
 import (
 	"encoding/binary"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
 	"github.com/kevburnsjr/crypto-art-games/internal/errors"
 	"github.com/kevburnsjr/crypto-art-games/internal/repo/driver"
 )
@@ -13,127 +15,432 @@ import (
 var tileLockTimeout = 10 * time.Minute
 
 type TileLock interface {
-	Acquire(userID uint32, boardID, tileID uint16, t time.Time) (err error)
-	Release(userID uint32, boardID, tileID uint16, t time.Time) (err error)
+	Acquire(userID uint32, boardID, tileID uint16, width, height uint8, t time.Time) (displaced []*entity.TileLock, err error)
+	Release(userID uint32, boardID, tileID uint16, t time.Time) (released *entity.TileLock, err error)
+	Use(userID uint32, boardID, tileID uint16, t time.Time) (err error)
+	ReleaseUser(userID uint32, t time.Time) (released []*entity.TileLock, err error)
+	Board(boardID uint16, t time.Time) (locks []*entity.TileLock, err error)
+	Sweep(t time.Time) (expired []*entity.TileLock, err error)
 }
 
 // NewTileLock returns an TileLock repo instance
 func NewTileLock(cfg config.KeyValueStore) (r *tileLock, err error) {
-	var tileDB driver.DB
-	var userDB driver.DB
-	if cfg.LevelDB != nil {
-		tileDBCfg := *cfg.LevelDB
-		tileDBCfg.Path += "-tile"
-		tileDB, err = driver.NewLevelDB(tileDBCfg)
-		userDBCfg := *cfg.LevelDB
-		userDBCfg.Path += "-user"
-		userDB, err = driver.NewLevelDB(userDBCfg)
-	}
-	if err != nil || tileDB == nil {
+	db, err := driver.New(cfg)
+	if err != nil || db == nil {
 		return
 	}
 	return &tileLock{
-		tileDB: tileDB,
-		userDB: userDB,
+		db: db,
 	}, nil
 }
 
+// Each tile of a lock's region is keyed by board and tile under tileLockTilePrefix with a reverse
+// index from user and board to the lock under tileLockUserPrefix. Every entry of a lock holds the
+// same value identifying the lock. All writes are made in batch transactions holding the repo's
+// mutex.
+var (
+	tileLockTilePrefix = []byte("t")
+	tileLockUserPrefix = []byte("u")
+)
+
 type tileLock struct {
-	tileDB driver.DB
-	userDB driver.DB
+	db    driver.DB
+	mutex sync.Mutex // Held by batch transactions
 }
 
-// Acquire inserts a tileLock
-func (r *tileLock) Acquire(userID uint32, boardID, tileID uint16, t time.Time) (err error) {
-	// Clear any existing locks belonging to this user
-	var userKey = make([]byte, 4)
-	binary.BigEndian.PutUint32(userKey[0:4], userID)
-	_, b, err := r.userDB.Get(userKey)
-	if err == errors.RepoItemNotFound {
-		if err = r.tileDB.Delete(b, ""); err != nil {
-			return
+func tileLockTileKey(boardID, tileID uint16) []byte {
+	var key = make([]byte, 5)
+	copy(key, tileLockTilePrefix)
+	binary.BigEndian.PutUint16(key[1:3], boardID)
+	binary.BigEndian.PutUint16(key[3:5], tileID)
+	return key
+}
+
+func tileLockUserKey(userID uint32, boardID uint16) []byte {
+	var key = make([]byte, 7)
+	copy(key, tileLockUserPrefix)
+	binary.BigEndian.PutUint32(key[1:5], userID)
+	binary.BigEndian.PutUint16(key[5:7], boardID)
+	return key
+}
+
+func tileLockValue(l *entity.TileLock) []byte {
+	var val = make([]byte, 12)
+	binary.BigEndian.PutUint32(val[0:4], l.UserID)
+	binary.BigEndian.PutUint32(val[4:8], l.Expires)
+	binary.BigEndian.PutUint16(val[8:10], l.TileID)
+	val[10] = l.Width
+	val[11] = l.Height
+	return val
+}
+
+// tileLockFromValue parses a lock value. Values stored before region locks cover only the tile
+// they are stored under.
+func tileLockFromValue(boardID, tileID uint16, val []byte) *entity.TileLock {
+	var l = &entity.TileLock{BoardID: boardID, TileID: tileID, Width: 1, Height: 1}
+	switch len(val) {
+	case 12:
+		l.TileID = binary.BigEndian.Uint16(val[8:10])
+		l.Width = val[10]
+		l.Height = val[11]
+	case 8:
+	default:
+		return nil
+	}
+	l.UserID = binary.BigEndian.Uint32(val[0:4])
+	l.Expires = binary.BigEndian.Uint32(val[4:8])
+	return l
+}
+
+// tileLockFromKV returns the lock holding a tile entry with the entry's tile in Tiles
+func tileLockFromKV(key, val []byte) *entity.TileLock {
+	if len(key) != 5 {
+		return nil
+	}
+	var tileID = binary.BigEndian.Uint16(key[3:5])
+	l := tileLockFromValue(binary.BigEndian.Uint16(key[1:3]), tileID, val)
+	if l != nil {
+		l.Tiles = []uint16{tileID}
+	}
+	return l
+}
+
+// Acquire locks a region of tiles for the user or extends the user's lock on the same region.
+// A user may hold one unexpired lock per board. Returns the tiles of expired locks displaced by
+// the region so that their owners may be refunded.
+func (r *tileLock) Acquire(userID uint32, boardID, tileID uint16, width, height uint8, t time.Time) (displaced []*entity.TileLock, err error) {
+	var l = &entity.TileLock{
+		BoardID: boardID,
+		TileID:  tileID,
+		Width:   width,
+		Height:  height,
+		UserID:  userID,
+		Expires: uint32(t.Add(tileLockTimeout).Unix()),
+	}
+	l.Tiles = l.Region()
+	if len(l.Tiles) == 0 {
+		return nil, fmt.Errorf("Invalid tile lock region")
+	}
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	held, err := userTileLock(tx, userID, boardID)
+	if err != nil {
+		return
+	}
+	if held != nil && len(held.Tiles) > 0 && !held.Expired(t) &&
+		(held.TileID != tileID || held.Width != width || held.Height != height) {
+		return nil, fmt.Errorf("Tile lock already held on tile %02x", held.TileID)
+	}
+	var byValue = map[string]*entity.TileLock{}
+	for _, tile := range l.Tiles {
+		current, err := tileLockGet(tx, tileLockTileKey(boardID, tile))
+		if err != nil {
+			return nil, err
 		}
-	} else if err != nil {
+		if current == nil {
+			continue
+		}
+		if !current.Expired(t) {
+			if current.UserID != userID {
+				return nil, fmt.Errorf("Tile locked")
+			}
+			// The user's lock on the region is extended
+			continue
+		}
+		var id = string(tileLockValue(current))
+		if d, ok := byValue[id]; ok {
+			d.Tiles = append(d.Tiles, tile)
+		} else {
+			byValue[id] = current
+			displaced = append(displaced, current)
+		}
+	}
+	var val = tileLockValue(l)
+	for _, tile := range l.Tiles {
+		if _, err = tx.Put(tileLockTileKey(boardID, tile), "", val); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = tx.Put(tileLockUserKey(userID, boardID), "", val); err != nil {
+		return nil, err
+	}
+	// Remaining tiles of displaced locks are left to Sweep
+	for _, d := range displaced {
+		remaining, err := tileLockHeld(tx, d)
+		if err != nil {
+			return nil, err
+		}
+		if len(remaining) > 0 {
+			continue
+		}
+		if err = deleteTileLockUser(tx, d); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Release deletes the user's unexpired lock holding a tile returning the lock with the tiles
+// released. The whole region is released.
+func (r *tileLock) Release(userID uint32, boardID uint16, tileID uint16, t time.Time) (released *entity.TileLock, err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	l, err := r.owned(tx, userID, boardID, tileID, t)
+	if err != nil {
 		return
 	}
+	if released, err = removeTileLock(tx, l); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return
+}
 
-	var key = make([]byte, 4)
-	binary.BigEndian.PutUint16(key[0:2], boardID)
-	binary.BigEndian.PutUint16(key[2:4], tileID)
+// Use deletes a single tile from the user's unexpired lock holding the tile. The rest of the
+// region remains locked.
+func (r *tileLock) Use(userID uint32, boardID uint16, tileID uint16, t time.Time) (err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	l, err := r.owned(tx, userID, boardID, tileID, t)
+	if err != nil {
+		return
+	}
+	if err = tx.Delete(tileLockTileKey(boardID, tileID), ""); err != nil {
+		return
+	}
+	remaining, err := tileLockHeld(tx, l)
+	if err != nil {
+		return
+	}
+	if len(remaining) == 0 {
+		if err = deleteTileLockUser(tx, l); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
 
-	_, val, err := r.tileDB.Get(key)
-	if err == errors.RepoItemNotFound {
-		return r.acquire(key, userID, t)
-	} else if err != nil {
+// owned returns the lock holding a tile provided it is unexpired and belongs to the user
+func (r *tileLock) owned(tx driver.Transaction, userID uint32, boardID, tileID uint16, t time.Time) (l *entity.TileLock, err error) {
+	l, err = tileLockGet(tx, tileLockTileKey(boardID, tileID))
+	if err != nil {
 		return
-	} else if len(val) == 8 {
-		if binary.BigEndian.Uint32(val[0:4]) == userID {
-			return r.acquire(key, userID, t)
+	}
+	if l == nil {
+		return nil, fmt.Errorf("Tile not locked %02x", tileID)
+	}
+	if l.Expired(t) {
+		return nil, fmt.Errorf("Tile lock expired")
+	}
+	if l.UserID != userID {
+		return nil, fmt.Errorf("Tile locked by another user")
+	}
+	return
+}
+
+// ReleaseUser deletes the user's locks on every board returning the locks released. Locks expired
+// before t are left to Sweep.
+func (r *tileLock) ReleaseUser(userID uint32, t time.Time) (released []*entity.TileLock, err error) {
+	iter, err := r.db.PrefixIterator(tileLockUserKey(userID, 0)[:5])
+	if err != nil {
+		return
+	}
+	var locks []*entity.TileLock
+	for iter.Next() {
+		l := tileLockFromValue(binary.BigEndian.Uint16(iter.Key()[5:7]), 0, iter.Value()[16:])
+		if l != nil && l.UserID == userID && !l.Expired(t) {
+			locks = append(locks, l)
+		}
+	}
+	err = iter.Error()
+	iter.Release()
+	if err != nil {
+		return
+	}
+	for _, l := range locks {
+		l, err := r.expire(l)
+		if err != nil {
+			return released, err
 		}
-		if time.Unix(int64(binary.BigEndian.Uint32(val[4:8])), 0).Before(t) {
-			return r.acquire(key, userID, t)
+		if l != nil {
+			released = append(released, l)
 		}
 	}
-	return fmt.Errorf("Tile locked")
+	return
+}
+
+// Board returns the locks on a board unexpired at t
+func (r *tileLock) Board(boardID uint16, t time.Time) (locks []*entity.TileLock, err error) {
+	locks = []*entity.TileLock{}
+	var prefix = tileLockTileKey(boardID, 0)[:3]
+	iter, err := r.db.PrefixIterator(prefix)
+	if err != nil {
+		return
+	}
+	defer iter.Release()
+	locks = groupTileLocks(iter, func(l *entity.TileLock) bool { return !l.Expired(t) })
+	if locks == nil {
+		locks = []*entity.TileLock{}
+	}
+	err = iter.Error()
+	return
 }
 
-func (r *tileLock) acquire(key []byte, userID uint32, t time.Time) (err error) {
-	var val = make([]byte, 8)
-	binary.BigEndian.PutUint32(val[0:4], userID)
-	binary.BigEndian.PutUint32(val[4:8], uint32(t.Add(tileLockTimeout).Unix()))
-	if _, err = r.tileDB.Put(key, "", val); err != nil {
+// Sweep deletes all locks expired at t returning the expired locks. Locks acquired again
+// while sweeping are left in place.
+func (r *tileLock) Sweep(t time.Time) (expired []*entity.TileLock, err error) {
+	iter, err := r.db.PrefixIterator(tileLockTilePrefix)
+	if err != nil {
 		return
 	}
-	if _, err = r.userDB.Put(val[0:4], "", key); err != nil {
+	candidates := groupTileLocks(iter, func(l *entity.TileLock) bool { return l.Expired(t) })
+	err = iter.Error()
+	iter.Release()
+	if err != nil {
 		return
 	}
+	for _, l := range candidates {
+		l, err := r.expire(l)
+		if err != nil {
+			return expired, err
+		}
+		if l != nil {
+			expired = append(expired, l)
+		}
+	}
 	return
 }
 
-// Release deletes a tileLock
-func (r *tileLock) Release(userID uint32, boardID uint16, tileID uint16, t time.Time) (err error) {
-	var key = make([]byte, 4)
-	binary.BigEndian.PutUint16(key[0:2], boardID)
-	binary.BigEndian.PutUint16(key[2:4], uint16(tileID))
+// groupTileLocks collects the tile entries matching fn into their locks
+func groupTileLocks(iter driver.Iterator, fn func(l *entity.TileLock) bool) (locks []*entity.TileLock) {
+	var byValue = map[string]*entity.TileLock{}
+	for iter.Next() {
+		l := tileLockFromKV(iter.Key(), iter.Value()[16:])
+		if l == nil || !fn(l) {
+			continue
+		}
+		var id = string(iter.Key()[1:3]) + string(tileLockValue(l))
+		if l2, ok := byValue[id]; ok {
+			l2.Tiles = append(l2.Tiles, l.Tiles...)
+			continue
+		}
+		byValue[id] = l
+		locks = append(locks, l)
+	}
+	return
+}
 
-	vers, val, err := r.tileDB.Get(key)
+// expire deletes the tiles still held by a lock and its user entry returning the lock with the
+// tiles deleted or nil if the lock is no longer held
+func (r *tileLock) expire(l *entity.TileLock) (removed *entity.TileLock, err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	removed, err = removeTileLock(tx, l)
+	if err != nil || len(removed.Tiles) == 0 {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// userTileLock returns the user's lock on a board with the tiles still held or nil if none
+func userTileLock(tx driver.Transaction, userID uint32, boardID uint16) (l *entity.TileLock, err error) {
+	_, val, err := tx.Get(tileLockUserKey(userID, boardID))
+	if err == errors.RepoItemNotFound {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	if l = tileLockFromValue(boardID, 0, val); l == nil {
+		return
+	}
+	l.Tiles, err = tileLockHeld(tx, l)
+	return
+}
+
+// tileLockGet returns the lock holding a tile or nil if the tile is not locked
+func tileLockGet(rw driver.ReadWriter, key []byte) (l *entity.TileLock, err error) {
+	_, val, err := rw.Get(key)
 	if err == errors.RepoItemNotFound {
-		return fmt.Errorf("Tile not locked %02x", tileID)
+		return nil, nil
 	} else if err != nil {
 		return
-	} else {
-		//
-		// This is really obnoxious. Need a better solution.
-		//
-		if len(val) == 8 && time.Unix(int64(binary.BigEndian.Uint32(val[4:8])), 0).Before(t) {
-			return fmt.Errorf("Tile lock expired")
+	}
+	return tileLockFromKV(key, val), nil
+}
+
+// tileLockHeld returns the tiles of a lock's region still held by the lock
+func tileLockHeld(rw driver.ReadWriter, l *entity.TileLock) (tiles []uint16, err error) {
+	for _, tile := range l.Region() {
+		current, err := tileLockGet(rw, tileLockTileKey(l.BoardID, tile))
+		if err != nil {
+			return nil, err
+		}
+		if current != nil && current.Same(l) {
+			tiles = append(tiles, tile)
 		}
 	}
-	if binary.BigEndian.Uint32(val[0:4]) != userID {
-		return fmt.Errorf("Tile locked by another user")
+	return
+}
+
+// removeTileLock deletes the tiles still held by a lock and its user entry returning the lock
+// with the tiles deleted
+func removeTileLock(tx driver.Transaction, l *entity.TileLock) (removed *entity.TileLock, err error) {
+	tiles, err := tileLockHeld(tx, l)
+	if err != nil {
+		return
 	}
-	if err = r.userDB.Delete(val[0:4], ""); err != nil {
+	for _, tile := range tiles {
+		if err = tx.Delete(tileLockTileKey(l.BoardID, tile), ""); err != nil {
+			return
+		}
+	}
+	if err = deleteTileLockUser(tx, l); err != nil {
 		return
 	}
+	removed = &entity.TileLock{}
+	*removed = *l
+	removed.Tiles = tiles
+	return
+}
 
-	return r.tileDB.Delete(key, vers)
+// deleteTileLockUser deletes the user entry of a lock if it still refers to the lock
+func deleteTileLockUser(tx driver.Transaction, l *entity.TileLock) (err error) {
+	var userKey = tileLockUserKey(l.UserID, l.BoardID)
+	_, val, err := tx.Get(userKey)
+	if err == errors.RepoItemNotFound {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if current := tileLockFromValue(l.BoardID, 0, val); current == nil || !current.Same(l) {
+		return
+	}
+	return tx.Delete(userKey, "")
 }
 
 // All returns all records from the table
 func (r *tileLock) All() (all map[string]string, err error) {
 	all = map[string]string{}
-	keys, vals, err := r.tileDB.GetRanged(nil, 0, false)
+	iter, err := r.db.PrefixIterator(tileLockTilePrefix)
 	if err != nil {
 		return
 	}
-	for i, v := range vals {
-		all[string(keys[i])] = string(v)
+	defer iter.Release()
+	for iter.Next() {
+		all[string(iter.Key()[1:])] = string(iter.Value()[16:])
 	}
 	return
 }
 
 // Close closes a database connection
 func (r *tileLock) Close() {
-	r.tileDB.Close()
-	r.userDB.Close()
+	r.db.Close()
 }
@@ -0,0 +1,320 @@
+package repo
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestTileLockAcquire(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	var expires = uint32(now.Add(tileLockTimeout).Unix())
+	_, err := r.Acquire(1, 1, 10, 1, 1, now)
+	require.Nil(t, err)
+
+	// Locked by another user
+	_, err = r.Acquire(2, 1, 10, 1, 1, now)
+	require.NotNil(t, err)
+
+	// One lock per user per board
+	_, err = r.Acquire(1, 1, 11, 1, 1, now)
+	require.NotNil(t, err)
+	_, err = r.Acquire(1, 2, 11, 1, 1, now)
+	require.Nil(t, err)
+
+	// Acquiring the same tile again extends the lock
+	_, err = r.Acquire(1, 1, 10, 1, 1, now.Add(time.Minute))
+	require.Nil(t, err)
+	locks, err := r.Board(1, now)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(1, 10, 1, 1, 1, expires+60, 10)}, locks)
+
+	// An expired lock is displaced and returned for refund
+	var later = now.Add(tileLockTimeout + 2*time.Minute)
+	displaced, err := r.Acquire(2, 1, 10, 1, 1, later)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(1, 10, 1, 1, 1, expires+60, 10)}, displaced)
+	_, err = r.Release(1, 1, 10, later)
+	require.NotNil(t, err)
+	released, err := r.Release(2, 1, 10, later)
+	require.Nil(t, err)
+	require.Equal(t, []uint16{10}, released.Tiles)
+
+	// A user whose lock expired may lock another tile leaving the expired lock to be swept
+	_, err = r.Acquire(1, 2, 12, 1, 1, later)
+	require.Nil(t, err)
+	expired, err := r.Sweep(later)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(2, 11, 1, 1, 1, expires, 11)}, expired)
+	locks, err = r.Board(2, later)
+	require.Nil(t, err)
+	require.Len(t, locks, 1)
+	_, err = r.Release(1, 2, 12, later)
+	require.Nil(t, err)
+}
+
+func TestTileLockRegion(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	var expires = uint32(now.Add(tileLockTimeout).Unix())
+
+	// Regions must fit on the board
+	for _, region := range [][3]int{{0x0f, 1, 2}, {0xf0, 2, 1}, {0x00, 0, 1}, {0x100, 1, 1}} {
+		_, err := r.Acquire(1, 1, uint16(region[0]), uint8(region[1]), uint8(region[2]), now)
+		require.NotNil(t, err, "%v", region)
+	}
+
+	_, err := r.Acquire(1, 1, 0x11, 2, 2, now)
+	require.Nil(t, err)
+	locks, err := r.Board(1, now)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(1, 0x11, 2, 2, 1, expires, 0x11, 0x12, 0x21, 0x22)}, locks)
+
+	// Overlapping regions are refused
+	_, err = r.Acquire(2, 1, 0x22, 1, 1, now)
+	require.NotNil(t, err)
+	_, err = r.Acquire(2, 1, 0x00, 2, 2, now)
+	require.NotNil(t, err)
+	_, err = r.Acquire(2, 1, 0x13, 2, 2, now)
+	require.Nil(t, err)
+
+	// Using a tile leaves the rest of the region locked
+	require.Nil(t, r.Use(1, 1, 0x12, now))
+	require.NotNil(t, r.Use(1, 1, 0x12, now))
+	require.NotNil(t, r.Use(2, 1, 0x21, now))
+	locks, err = r.Board(1, now)
+	require.Nil(t, err)
+	require.Len(t, locks, 2)
+	require.Equal(t, []uint16{0x11, 0x21, 0x22}, locks[0].Tiles)
+
+	// Releasing any tile releases the region
+	released, err := r.Release(1, 1, 0x22, now)
+	require.Nil(t, err)
+	require.Equal(t, testTileLockEntity(1, 0x11, 2, 2, 1, expires, 0x11, 0x21, 0x22), released)
+	_, _, err = r.db.Get(tileLockUserKey(1, 1))
+	require.NotNil(t, err)
+
+	// Using every tile releases the user entry
+	for _, tile := range []uint16{0x13, 0x14, 0x23, 0x24} {
+		require.Nil(t, r.Use(2, 1, tile, now))
+	}
+	_, _, err = r.db.Get(tileLockUserKey(2, 1))
+	require.NotNil(t, err)
+	locks, err = r.Board(1, now)
+	require.Nil(t, err)
+	require.Len(t, locks, 0)
+
+	// Displacing part of an expired region leaves the rest to be swept
+	_, err = r.Acquire(1, 1, 0x00, 2, 1, now)
+	require.Nil(t, err)
+	var later = now.Add(tileLockTimeout + time.Second)
+	displaced, err := r.Acquire(2, 1, 0x10, 1, 1, later)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(1, 0x00, 2, 1, 1, expires, 0x10)}, displaced)
+	expired, err := r.Sweep(later)
+	require.Nil(t, err)
+	require.Equal(t, []*entity.TileLock{testTileLockEntity(1, 0x00, 2, 1, 1, expires, 0x00)}, expired)
+	_, _, err = r.db.Get(tileLockUserKey(1, 1))
+	require.NotNil(t, err)
+}
+
+func TestTileLockAcquireConcurrent(t *testing.T) {
+	for name, cfg := range map[string]config.KeyValueStore{
+		"inmemory":  testInMemory(),
+		"namespace": testRepos().TileLock,
+		"leveldb":   {LevelDB: &config.LevelDB{Path: filepath.Join(t.TempDir(), "leveldb")}},
+		"boltdb":    {BoltDB: &config.BoltDB{Path: filepath.Join(t.TempDir(), "boltdb")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := testTileLock(t, cfg)
+			defer r.Close()
+			var now = time.Unix(1e9, 0)
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			var winners = map[uint16][]uint32{}
+			var userLocks = map[uint32]int{}
+			for u := uint32(1); u <= 32; u++ {
+				for tile := uint16(0); tile < 4; tile++ {
+					wg.Add(1)
+					go func(userID uint32, tileID uint16) {
+						defer wg.Done()
+						if _, err := r.Acquire(userID, 1, tileID, 1, 1, now); err == nil {
+							mutex.Lock()
+							winners[tileID] = append(winners[tileID], userID)
+							userLocks[userID]++
+							mutex.Unlock()
+						}
+					}(u, tile)
+				}
+			}
+			wg.Wait()
+			require.Len(t, winners, 4)
+			for tileID, users := range winners {
+				require.Len(t, users, 1, "Tile %d", tileID)
+			}
+			for userID, n := range userLocks {
+				require.Equal(t, 1, n, "User %d", userID)
+			}
+			locks, err := r.Board(1, now)
+			require.Nil(t, err)
+			require.Len(t, locks, 4)
+			for _, l := range locks {
+				require.Equal(t, winners[l.TileID][0], l.UserID)
+			}
+		})
+	}
+}
+
+func TestTileLockRegionConcurrent(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var owners = map[uint16]uint32{}
+	for u := uint32(1); u <= 64; u++ {
+		wg.Add(1)
+		go func(userID uint32) {
+			defer wg.Done()
+			// Overlapping 2x2 regions within a 4x4 area
+			var origin = uint16((userID%3)*16 + userID/3%3)
+			if _, err := r.Acquire(userID, 1, origin, 2, 2, now); err != nil {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, tile := range (&entity.TileLock{TileID: origin, Width: 2, Height: 2}).Region() {
+				if owner, ok := owners[tile]; ok {
+					t.Errorf("Tile %02x locked by users %d and %d", tile, owner, userID)
+				}
+				owners[tile] = userID
+			}
+		}(u)
+	}
+	wg.Wait()
+	locks, err := r.Board(1, now)
+	require.Nil(t, err)
+	var n int
+	for _, l := range locks {
+		require.Len(t, l.Tiles, 4)
+		for _, tile := range l.Tiles {
+			require.Equal(t, owners[tile], l.UserID)
+		}
+		n += len(l.Tiles)
+	}
+	require.Equal(t, len(owners), n)
+}
+
+func TestTileLockReleaseConcurrent(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	_, err := r.Acquire(1, 1, 10, 1, 1, now)
+	require.Nil(t, err)
+	var wg sync.WaitGroup
+	var released = make(chan bool, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Release(1, 1, 10, now); err == nil {
+				released <- true
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, released, 1)
+}
+
+func TestTileLockSweep(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	_, err := r.Acquire(1, 1, 10, 1, 1, now)
+	require.Nil(t, err)
+	_, err = r.Acquire(2, 1, 11, 1, 1, now.Add(tileLockTimeout/2))
+	require.Nil(t, err)
+	_, err = r.Acquire(3, 2, 10, 1, 1, now)
+	require.Nil(t, err)
+
+	locks, err := r.Board(1, now)
+	require.Nil(t, err)
+	require.Len(t, locks, 2)
+	require.Equal(t, testTileLockEntity(1, 10, 1, 1, 1, uint32(now.Add(tileLockTimeout).Unix()), 10), locks[0])
+
+	var later = now.Add(tileLockTimeout + time.Second)
+	locks, err = r.Board(1, later)
+	require.Nil(t, err)
+	require.Len(t, locks, 1)
+	require.Equal(t, uint32(2), locks[0].UserID)
+
+	expired, err := r.Sweep(later)
+	require.Nil(t, err)
+	require.Len(t, expired, 2)
+	require.Equal(t, uint32(1), expired[0].UserID)
+	require.Equal(t, uint32(3), expired[1].UserID)
+
+	// Swept locks and their user entries are gone
+	expired, err = r.Sweep(later)
+	require.Nil(t, err)
+	require.Len(t, expired, 0)
+	_, _, err = r.db.Get(tileLockUserKey(1, 1))
+	require.NotNil(t, err)
+	_, _, err = r.db.Get(tileLockUserKey(2, 1))
+	require.Nil(t, err)
+	_, err = r.Release(1, 1, 10, later)
+	require.NotNil(t, err)
+}
+
+func TestTileLockReleaseUser(t *testing.T) {
+	r := testTileLock(t, testInMemory())
+	var now = time.Unix(1e9, 0)
+	for _, boardID := range []uint16{1, 2} {
+		_, err := r.Acquire(1, boardID, 10, 1, 1, now)
+		require.Nil(t, err)
+	}
+	_, err := r.Acquire(2, 1, 11, 1, 1, now)
+	require.Nil(t, err)
+
+	released, err := r.ReleaseUser(1, now)
+	require.Nil(t, err)
+	require.Len(t, released, 2)
+	require.Equal(t, testTileLockEntity(1, 10, 1, 1, 1, uint32(now.Add(tileLockTimeout).Unix()), 10), released[0])
+	require.Equal(t, uint16(2), released[1].BoardID)
+	released, err = r.ReleaseUser(1, now)
+	require.Nil(t, err)
+	require.Len(t, released, 0)
+	locks, err := r.Board(1, now)
+	require.Nil(t, err)
+	require.Len(t, locks, 1)
+
+	// Expired locks are left to the sweeper
+	released, err = r.ReleaseUser(2, now.Add(tileLockTimeout+time.Second))
+	require.Nil(t, err)
+	require.Len(t, released, 0)
+	expired, err := r.Sweep(now.Add(tileLockTimeout + time.Second))
+	require.Nil(t, err)
+	require.Len(t, expired, 1)
+}
+
+func testTileLock(t *testing.T, cfg config.KeyValueStore) *tileLock {
+	r, err := NewTileLock(cfg)
+	require.Nil(t, err)
+	return r
+}
+
+func testTileLockEntity(boardID, tileID uint16, width, height uint8, userID, expires uint32, tiles ...uint16) *entity.TileLock {
+	return &entity.TileLock{
+		BoardID: boardID,
+		TileID:  tileID,
+		Width:   width,
+		Height:  height,
+		UserID:  userID,
+		Expires: expires,
+		Tiles:   tiles,
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
@@ -22,17 +23,14 @@ type User interface {
 	Update(user *entity.User) (err error)
 	UpdateProfile(user *entity.User) (u *entity.User, err error)
 	Since(userIdx uint32) (users []*entity.User, userIds []uint32, err error)
-	Consume(user *entity.User, boardId uint16) (err error)
-	Credit(user *entity.User, boardId uint16) (err error)
+	Consume(user *entity.User, board *entity.Board, n int) (err error)
+	Credit(user *entity.User, board *entity.Board, n int) (err error)
 	All() (all []*entity.User, err error)
 }
 
 // NewUser returns an User repo instance
 func NewUser(cfg config.KeyValueStore) (r *user, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -42,7 +40,8 @@ func NewUser(cfg config.KeyValueStore) (r *user, err error) {
 }
 
 type user struct {
-	db driver.DB
+	db    driver.DB
+	mutex sync.Mutex // Held by batch transactions and bucket updates
 }
 
 // Find retrieves a user
@@ -107,7 +106,9 @@ func (r *user) FindOrInsert(user *entity.User) (userID uint32, inserted bool, er
 }
 
 func (r *user) Insert(user *entity.User) (userID uint32, err error) {
-	idVers, idBytes, err := r.db.Get([]byte("_id"))
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	idVers, idBytes, err := tx.Get([]byte("_id"))
 	if err == errors.RepoItemNotFound {
 		userID = uint32(1)
 		err = nil
@@ -120,26 +121,55 @@ func (r *user) Insert(user *entity.User) (userID uint32, err error) {
 	idBytes = make([]byte, 4)
 	binary.BigEndian.PutUint32(idBytes, userID)
 
-	_, err = r.db.Put([]byte("_id"), idVers, idBytes)
+	_, err = tx.Put([]byte("_id"), idVers, idBytes)
 	if err != nil {
 		return
 	}
 
 	user.UserID = userID
 
-	_, err = r.db.Put(idBytes, "", user.ToJson())
+	_, err = tx.Put(idBytes, "", user.ToJson())
 	if err != nil {
 		return
 	}
 
-	_, err = r.db.Put([]byte("twitch-"+user.ID), "", idBytes)
+	_, err = tx.Put([]byte("twitch-"+user.ID), "", idBytes)
 	if err != nil {
 		return
 	}
 
+	err = tx.Commit()
 	return
 }
 
+// put writes a user with its existing UserID advancing the id sequence past it if necessary
+func (r *user) put(user *entity.User) (err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	idVers, idBytes, err := tx.Get([]byte("_id"))
+	if err == errors.RepoItemNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	if len(idBytes) < 4 || binary.BigEndian.Uint32(idBytes) < user.UserID {
+		idBytes = make([]byte, 4)
+		binary.BigEndian.PutUint32(idBytes, user.UserID)
+		if _, err = tx.Put([]byte("_id"), idVers, idBytes); err != nil {
+			return
+		}
+	}
+	idBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(idBytes, user.UserID)
+	if _, err = tx.Put(idBytes, "", user.ToJson()); err != nil {
+		return
+	}
+	if _, err = tx.Put([]byte("twitch-"+user.ID), "", idBytes); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
 func (r *user) Update(user *entity.User) (err error) {
 	idBytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(idBytes, user.UserID)
@@ -171,52 +201,64 @@ func (r *user) UpdateProfile(user *entity.User) (u *entity.User, err error) {
 	return
 }
 
-func (r *user) Consume(user *entity.User, boardId uint16) (err error) {
-	if user.Buckets == nil {
-		user.Buckets = map[uint16]*entity.UserBucket{}
-	}
-	bucket, ok := user.Buckets[boardId]
-	if !ok {
-		bucket = entity.NewUserBucket(time.Now())
-		user.Buckets[boardId] = bucket
-	}
-	if !bucket.Consume(1, time.Now()) {
-		return fmt.Errorf("Insufficient tile credits")
-	}
-	idBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(idBytes, user.UserID)
-	userVers, _, err := r.db.Get(idBytes)
-	if err != nil {
-		return
-	}
-	_, err = r.db.Put(idBytes, userVers, user.ToJson())
-	if err != nil {
-		return
-	}
+// Consume deducts the cost of locking n tiles from the user's bucket for a board. Fails if the
+// cost exceeds the size of the bucket.
+func (r *user) Consume(user *entity.User, board *entity.Board, n int) (err error) {
+	return r.updateBucket(user, board, func(bucket *entity.UserBucket, t time.Time) error {
+		var credits = n * int(board.GetEconomy().Cost)
+		if n < 0 || credits > int(bucket.Size) || !bucket.Consume(uint8(credits), t) {
+			return fmt.Errorf("Insufficient tile credits")
+		}
+		return nil
+	})
+}
 
-	return
+// Credit refunds the cost of locking n tiles to the user's bucket for a board
+func (r *user) Credit(user *entity.User, board *entity.Board, n int) (err error) {
+	return r.updateBucket(user, board, func(bucket *entity.UserBucket, t time.Time) error {
+		var credits = n * int(board.GetEconomy().Cost)
+		if credits < 0 {
+			credits = 0
+		} else if credits > int(bucket.Size) {
+			credits = int(bucket.Size)
+		}
+		bucket.Credit(uint8(credits), t)
+		return nil
+	})
 }
 
-func (r *user) Credit(user *entity.User, boardId uint16) (err error) {
-	if user.Buckets == nil {
-		user.Buckets = map[uint16]*entity.UserBucket{}
-	}
-	bucket, ok := user.Buckets[boardId]
-	if !ok {
-		user.Buckets[boardId] = entity.NewUserBucket(time.Now())
+// updateBucket applies fn to the stored user's bucket for a board and copies the result to user.
+// The stored bucket is modified rather than user's copy so that credits written since user was
+// loaded, by the tile lock sweeper or another connection, are not lost.
+func (r *user) updateBucket(user *entity.User, board *entity.Board, fn func(bucket *entity.UserBucket, t time.Time) error) (err error) {
+	if board == nil {
+		return fmt.Errorf("Board not found")
 	}
-	bucket.Credit(1, time.Now())
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	idBytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(idBytes, user.UserID)
-	userVers, _, err := r.db.Get(idBytes)
+	userVers, userBytes, err := r.db.Get(idBytes)
 	if err != nil {
 		return
 	}
-	_, err = r.db.Put(idBytes, userVers, user.ToJson())
-	if err != nil {
+	stored := entity.UserFromJson(userBytes)
+	if stored == nil {
+		return fmt.Errorf("Invalid user %d", user.UserID)
+	}
+	var t = time.Now()
+	bucket := stored.GetBucket(board, t)
+	if err = fn(bucket, t); err != nil {
 		return
 	}
-
+	if _, err = r.db.Put(idBytes, userVers, stored.ToJson()); err != nil {
+		return
+	}
+	if user.Buckets == nil {
+		user.Buckets = map[uint16]*entity.UserBucket{}
+	}
+	var b = *bucket
+	user.Buckets[board.ID] = &b
 	return
 }
 
@@ -240,7 +282,7 @@ func (r *user) All() (all []*entity.User, err error) {
 func (r *user) Since(userIdx uint32) (users []*entity.User, userIds []uint32, err error) {
 	var start = make([]byte, 4)
 	binary.BigEndian.PutUint32(start, userIdx)
-	keys, vals, err := r.db.GetRanged(start, 0, false)
+	keys, vals, err := r.db.GetRanged(start, nil, 0, false)
 	if err != nil {
 		return
 	}
@@ -3,6 +3,7 @@ package repo
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
 
 	"github.com/kevburnsjr/crypto-art-games/internal/config"
 	"github.com/kevburnsjr/crypto-art-games/internal/entity"
@@ -18,10 +19,7 @@ type UserBan interface {
 
 // NewUserBan returns a UserBan repo instance
 func NewUserBan(cfg config.KeyValueStore) (r *userBan, err error) {
-	var db driver.DB
-	if cfg.LevelDB != nil {
-		db, err = driver.NewLevelDB(*cfg.LevelDB)
-	}
+	db, err := driver.New(cfg)
 	if err != nil || db == nil {
 		return
 	}
@@ -31,13 +29,16 @@ func NewUserBan(cfg config.KeyValueStore) (r *userBan, err error) {
 }
 
 type userBan struct {
-	db driver.DB
+	db    driver.DB
+	mutex sync.Mutex // Held by batch transactions
 }
 
 // Insert inserts a userBan
 func (r *userBan) Insert(userBan *entity.UserBan) (err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
 	var id uint32
-	idVers, idBytes, err := r.db.Get([]byte("_id"))
+	idVers, idBytes, err := tx.Get([]byte("_id"))
 	if err == errors.RepoItemNotFound {
 		id = uint32(1)
 	} else if err != nil {
@@ -51,20 +52,49 @@ func (r *userBan) Insert(userBan *entity.UserBan) (err error) {
 
 	userBan.ID = id
 
-	_, err = r.db.Put(idBytes, "", userBan.ToJson())
+	_, err = tx.Put(idBytes, "", userBan.ToJson())
 	if err != nil {
 		return
 	}
 
-	_, err = r.db.Put([]byte("_id"), idVers, idBytes)
-	return
+	_, err = tx.Put([]byte("_id"), idVers, idBytes)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// put writes a userBan with its existing ID advancing the id sequence past it if necessary
+func (r *userBan) put(userBan *entity.UserBan) (err error) {
+	tx := driver.NewBatchTransaction(r.db, &r.mutex)
+	defer tx.Discard()
+	idVers, idBytes, err := tx.Get([]byte("_id"))
+	if err == errors.RepoItemNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	if len(idBytes) < 4 || binary.BigEndian.Uint32(idBytes) < userBan.ID {
+		idBytes = make([]byte, 4)
+		binary.BigEndian.PutUint32(idBytes, userBan.ID)
+		if _, err = tx.Put([]byte("_id"), idVers, idBytes); err != nil {
+			return
+		}
+	}
+	idBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(idBytes, userBan.ID)
+	if _, err = tx.Put(idBytes, "", userBan.ToJson()); err != nil {
+		return
+	}
+	return tx.Commit()
 }
 
 // Since inserts all userBans since timecode
 func (r *userBan) Since(id uint32) (userBans []*entity.UserBan, err error) {
 	var start = make([]byte, 4)
 	binary.BigEndian.PutUint32(start, id)
-	keys, vals, err := r.db.GetRanged(start, 0, false)
+	keys, vals, err := r.db.GetRanged(start, nil, 0, false)
 	if err != nil {
 		return
 	}
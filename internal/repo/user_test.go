@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/nicklaw5/helix"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/entity"
+)
+
+func TestUser(t *testing.T) {
+	r, err := NewUser(testInMemory())
+	require.Nil(t, err)
+	for i, id := range []string{"a", "b", "a"} {
+		userID, inserted, err := r.FindOrInsert(&entity.User{User: helix.User{ID: id}})
+		require.Nil(t, err)
+		require.Equal(t, i < 2, inserted)
+		require.Equal(t, uint32(i%2+1), userID)
+	}
+	u, err := r.FindByUserID(2)
+	require.Nil(t, err)
+	require.Equal(t, "b", u.ID)
+
+	users, ids, err := r.Since(1)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{2}, ids)
+	require.Equal(t, "b", users[0].ID)
+
+	all, err := r.All()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(all))
+}
+
+func TestUserCredit(t *testing.T) {
+	r, err := NewUser(testInMemory())
+	require.Nil(t, err)
+	var u = &entity.User{User: helix.User{ID: "a"}}
+	_, _, err = r.FindOrInsert(u)
+	require.Nil(t, err)
+	var board = &entity.Board{ID: 1}
+
+	// Credit initializes a missing bucket
+	require.Nil(t, r.Credit(u, board, 1))
+	require.Nil(t, r.Consume(u, board, 4))
+	level := u.Buckets[1].Level
+	require.Nil(t, r.Credit(u, board, 2))
+	u, err = r.FindByUserID(u.UserID)
+	require.Nil(t, err)
+	require.Equal(t, level+8, u.Buckets[1].Level)
+
+	// Credits beyond the bucket size are refused
+	require.NotNil(t, r.Consume(u, board, 255))
+	require.NotNil(t, r.Consume(u, board, int(u.Buckets[1].Size)+1))
+	require.NotNil(t, r.Consume(u, nil, 1))
+
+	// Locking a whole board costs 256 tiles which must not wrap to a free lock
+	var area = len((&entity.TileLock{Width: 16, Height: 16}).Region())
+	require.Equal(t, 256, area)
+	level = u.Buckets[1].Level
+	require.NotNil(t, r.Consume(u, board, area))
+	require.Equal(t, level, u.Buckets[1].Level)
+	// Refunds of large areas fill the bucket rather than wrapping
+	require.Nil(t, r.Consume(u, board, 1))
+	require.Nil(t, r.Credit(u, board, area))
+	require.Equal(t, u.Buckets[1].Size*4, u.Buckets[1].Level)
+}
+
+func TestUserCreditStale(t *testing.T) {
+	r, err := NewUser(testInMemory())
+	require.Nil(t, err)
+	var u = &entity.User{User: helix.User{ID: "a"}}
+	_, _, err = r.FindOrInsert(u)
+	require.Nil(t, err)
+	var board = &entity.Board{ID: 1}
+	require.Nil(t, r.Consume(u, board, 4))
+	level := u.Buckets[1].Level
+
+	// The sweeper refunds a lock through a freshly loaded user
+	swept, err := r.FindByUserID(u.UserID)
+	require.Nil(t, err)
+	require.Nil(t, r.Credit(swept, board, 2))
+	require.Equal(t, level+8, swept.Buckets[1].Level)
+
+	// The connection's stale user consumes without erasing the refund
+	require.Nil(t, r.Consume(u, board, 1))
+	require.Equal(t, level+4, u.Buckets[1].Level)
+	stored, err := r.FindByUserID(u.UserID)
+	require.Nil(t, err)
+	require.Equal(t, level+4, stored.Buckets[1].Level)
+}
+
+func TestUserEconomy(t *testing.T) {
+	r, err := NewUser(testInMemory())
+	require.Nil(t, err)
+	var u = &entity.User{User: helix.User{ID: "a"}}
+	_, _, err = r.FindOrInsert(u)
+	require.Nil(t, err)
+	var series = &entity.Series{
+		Economy: &entity.Economy{Size: 4, Rate: 60, Level: 8, Cost: 2},
+		Boards:  []entity.Board{{ID: 1}, {ID: 2, Economy: &entity.Economy{Size: 16}}},
+	}
+
+	// New buckets take the series economy
+	require.Nil(t, r.Consume(u, series.Board(1), 1))
+	require.Equal(t, entity.UserBucket{Size: 4, Rate: 60, Level: 0, Timestamp: u.Buckets[1].Timestamp}, *u.Buckets[1])
+	require.NotNil(t, r.Consume(u, series.Board(1), 1))
+
+	// Board economies take precedence with defaults for zero fields
+	require.Nil(t, r.Consume(u, series.Board(2), 3))
+	require.Equal(t, entity.UserBucket{Size: 16, Rate: 15, Level: 20, Timestamp: u.Buckets[2].Timestamp}, *u.Buckets[2])
+
+	// Stored buckets are upgraded when the economy changes
+	series.Economy.Size = 2
+	series.Economy.Rate = 30
+	require.Nil(t, r.Credit(u, series.Board(1), 2))
+	u, err = r.FindByUserID(u.UserID)
+	require.Nil(t, err)
+	require.Equal(t, uint8(2), u.Buckets[1].Size)
+	require.Equal(t, uint8(30), u.Buckets[1].Rate)
+	require.Equal(t, uint8(8), u.Buckets[1].Level)
+}
@@ -1,29 +1,63 @@
 package socket
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// sendQueueSize is the number of messages queued for a connection before the hub applies
+// its slow consumer policy
+const sendQueueSize = 256
+
 type Connection interface {
 	Write(m wsmessage) error
 	Channels() []string
+	Resume(epoch string, seqs map[string]uint32)
+	OnClose(fn func())
+	Close()
 }
 
 func CreateConnection(ids []string, ws *websocket.Conn) *connection {
-	return &connection{channel_ids: ids, ws: ws, send: make(chan wsmessage, 256)}
+	return &connection{
+		channel_ids: ids,
+		ws:          ws,
+		notify:      make(chan bool, 1),
+		space:       make(chan bool, 1),
+		done:        make(chan bool),
+	}
 }
 
+// connection queues messages for a single Writer goroutine which is the only goroutine to write
+// to the websocket. Write blocks while the queue is full whereas messages delivered by the hub
+// never block and are subject to the hub's slow consumer policy.
 type connection struct {
-	channel_ids []string
-	ws          *websocket.Conn
-	send        chan wsmessage
+	channel_ids  []string
+	channelMutex sync.Mutex
+	ws           *websocket.Conn
+
+	queue  []wsmessage
+	mutex  sync.Mutex
+	notify chan bool
+	space  chan bool
+
+	done      chan bool
+	closeOnce sync.Once
+	reason    string
+	hooks     []func()
+	hookMutex sync.Mutex
+
+	sequenced bool
+	epoch     string
+	resume    map[string]uint32
 }
 
 func (c *connection) Reader(hub Hub, handler MessageHandler) {
 	defer func() {
 		hub.Unregister(c)
+		c.Close()
 		c.ws.Close()
 	}()
 	c.ws.SetReadLimit(maxMessageSize)
@@ -36,26 +70,200 @@ func (c *connection) Reader(hub Hub, handler MessageHandler) {
 		}
 		res, err := handler(t, b)
 		if err != nil {
-			c.send <- JsonMessagePure("", map[string]interface{}{
+			err = c.Write(JsonMessagePure("", map[string]interface{}{
 				"type": "err",
 				"msg":  err.Error(),
-			})
+			}))
 		} else if res != nil {
-			c.send <- wsmessage(*res)
+			err = c.Write(wsmessage(*res))
+		}
+		if err != nil {
+			break
 		}
 	}
 }
 
+// Write queues a message waiting for space if the queue is full
 func (c *connection) Write(m wsmessage) error {
-	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
-	return c.ws.WriteMessage(m.msgType, m.data)
+	for {
+		c.mutex.Lock()
+		if c.isClosed() {
+			c.mutex.Unlock()
+			return fmt.Errorf("Connection closed")
+		}
+		if len(c.queue) < sendQueueSize {
+			c.push(m)
+			c.mutex.Unlock()
+			return nil
+		}
+		c.mutex.Unlock()
+		select {
+		case <-c.space:
+		case <-c.done:
+		}
+	}
+}
+
+// deliver queues a message from the hub without blocking applying policy if the queue is full.
+// Returns false if the connection was closed.
+func (c *connection) deliver(m wsmessage, policy SlowConsumerPolicy) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isClosed() {
+		return false
+	}
+	if len(c.queue) < sendQueueSize {
+		c.push(m)
+		return true
+	}
+	switch policy {
+	case DropOldest:
+		c.queue = c.queue[1:]
+		c.push(m)
+		metrics.Add("dropped", 1)
+		return true
+	case Coalesce:
+		if len(m.key) > 0 {
+			for i := range c.queue {
+				if c.queue[i].key == m.key && c.queue[i].channel_id == m.channel_id {
+					c.queue[i] = m
+					metrics.Add("coalesced", 1)
+					return true
+				}
+			}
+		}
+	}
+	metrics.Add("disconnected", 1)
+	metrics.Add("dropped", int64(len(c.queue)+1))
+	c.queue = nil
+	c.close("Slow consumer")
+	return false
+}
+
+// push appends a message to the queue and wakes the writer. Caller must hold mutex.
+func (c *connection) push(m wsmessage) {
+	c.queue = append(c.queue, m)
+	select {
+	case c.notify <- true:
+	default:
+	}
+}
+
+// pop removes the oldest queued message
+func (c *connection) pop() (m wsmessage, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.queue) == 0 {
+		return
+	}
+	m = c.queue[0]
+	c.queue = c.queue[1:]
+	select {
+	case c.space <- true:
+	default:
+	}
+	return m, true
+}
+
+// Resume enables sequence numbers on broadcasts to the connection. When the connection next joins
+// a channel in seqs, the hub replays the broadcasts following the given sequence number if epoch
+// matches its own or otherwise sends resync-required. An empty epoch retains the previous epoch.
+func (c *connection) Resume(epoch string, seqs map[string]uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sequenced = true
+	if len(epoch) > 0 {
+		c.epoch = epoch
+	}
+	if c.resume == nil {
+		c.resume = map[string]uint32{}
+	}
+	for id, seq := range seqs {
+		c.resume[id] = seq
+	}
+}
+
+// takeResume removes and returns the resume point for a channel
+func (c *connection) takeResume(channel string) (epoch string, seq uint32, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if seq, ok = c.resume[channel]; ok {
+		delete(c.resume, channel)
+	}
+	return c.epoch, seq, ok
+}
+
+func (c *connection) isSequenced() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sequenced
+}
+
+// available returns the number of messages that may be queued before the queue is full
+func (c *connection) available() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return sendQueueSize - len(c.queue)
+}
+
+// Close closes the connection once all queued messages are written
+func (c *connection) Close() {
+	c.close("")
+}
+
+// OnClose registers a function to run in its own goroutine once the connection is closed.
+// Runs immediately if the connection is already closed.
+func (c *connection) OnClose(fn func()) {
+	c.hookMutex.Lock()
+	defer c.hookMutex.Unlock()
+	if c.isClosed() {
+		go fn()
+		return
+	}
+	c.hooks = append(c.hooks, fn)
+}
+
+// close stops the writer which sends a close message with the reason then runs close hooks.
+// May be called while holding mutex.
+func (c *connection) close(reason string) {
+	c.closeOnce.Do(func() {
+		c.reason = reason
+		close(c.done)
+		c.hookMutex.Lock()
+		hooks := c.hooks
+		c.hooks = nil
+		c.hookMutex.Unlock()
+		for _, fn := range hooks {
+			go fn()
+		}
+	})
 }
 
+func (c *connection) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Channels returns a copy of the connection's channels
 func (c *connection) Channels() []string {
-	return c.channel_ids
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
+	return append([]string{}, c.channel_ids...)
+}
+
+func (c *connection) setChannels(channels []string) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
+	c.channel_ids = channels
 }
 
 func (c *connection) hasChannel(ch1 string) bool {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
 	for _, ch2 := range c.channel_ids {
 		if ch1 == ch2 {
 			return true
@@ -64,24 +272,54 @@ func (c *connection) hasChannel(ch1 string) bool {
 	return false
 }
 
+func (c *connection) write(m wsmessage) error {
+	var data = m.data
+	// Direct binary writes are prefixed too so sequenced clients can tell them from broadcasts
+	if c.isSequenced() && (m.seq > 0 || m.msgType == websocket.BinaryMessage) {
+		data = sequencedData(m)
+	}
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteMessage(m.msgType, data)
+}
+
+// flush writes all queued messages
+func (c *connection) flush() error {
+	for {
+		m, ok := c.pop()
+		if !ok {
+			return nil
+		}
+		if err := c.write(m); err != nil {
+			return err
+		}
+	}
+}
+
 func (c *connection) Writer() {
 	pinger := time.NewTicker(pingPeriod)
 	defer func() {
 		pinger.Stop()
+		c.close("")
 		c.ws.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.Write(wsmessage{websocket.CloseMessage, "", nil})
+		case <-c.notify:
+			if err := c.flush(); err != nil {
 				return
 			}
-			if err := c.Write(message); err != nil {
+		case <-c.done:
+			if c.flush() != nil {
 				return
 			}
+			var code = websocket.CloseNormalClosure
+			if len(c.reason) > 0 {
+				code = websocket.CloseTryAgainLater
+			}
+			c.write(wsmessage{msgType: websocket.CloseMessage, data: websocket.FormatCloseMessage(code, c.reason)})
+			return
 		case <-pinger.C:
-			if err := c.Write(wsmessage{websocket.PingMessage, "", nil}); err != nil {
+			if err := c.write(wsmessage{msgType: websocket.PingMessage}); err != nil {
 				return
 			}
 		}
@@ -1,6 +1,9 @@
 package socket
 
 import (
+	"crypto/rand"
+	"expvar"
+	"fmt"
 	"time"
 )
 
@@ -10,6 +13,8 @@ const (
 	pingPeriod     = (pongWait * 9) / 10
 	timeSyncPeriod = 60 * time.Second
 	maxMessageSize = 512
+
+	replayLogSweepPeriod = time.Minute
 )
 
 type Hub interface {
@@ -22,17 +27,65 @@ type Hub interface {
 
 type MessageHandler func(int, []byte) (*Msg, error)
 
-func NewHub() *hub {
-	return &hub{
+// SlowConsumerPolicy determines how the hub treats a connection whose send queue is full
+type SlowConsumerPolicy int
+
+const (
+	// Disconnect closes the connection with a reason
+	Disconnect SlowConsumerPolicy = iota
+	// DropOldest discards the oldest queued message
+	DropOldest
+	// Coalesce replaces a queued message having the same coalesce key, otherwise disconnects
+	Coalesce
+)
+
+// ParseSlowConsumerPolicy parses a policy name defaulting to Disconnect
+func ParseSlowConsumerPolicy(s string) (p SlowConsumerPolicy, err error) {
+	switch s {
+	case "", "disconnect":
+		return Disconnect, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "coalesce":
+		return Coalesce, nil
+	}
+	return Disconnect, fmt.Errorf("Unknown slow consumer policy %s", s)
+}
+
+// metrics counts messages dropped, coalesced and replayed, connections disconnected for being
+// slow and resumes requiring a resync
+var metrics = expvar.NewMap("socket")
+
+// NewHub returns a hub delivering messages published to the transport by any hub
+func NewHub(t Transport, policy SlowConsumerPolicy) (h *hub, err error) {
+	var epoch = make([]byte, 4)
+	rand.Read(epoch)
+	h = &hub{
+		transport:   t,
+		policy:      policy,
+		epoch:       fmt.Sprintf("%08x", epoch),
+		logs:        make(map[string]*replayLog),
 		connections: make(map[string]map[*connection]bool),
 		broadcast:   make(chan wsmessage),
 		register:    make(chan *connection),
 		unregister:  make(chan *connection),
 		update:      make(chan *connection),
 	}
+	err = t.Subscribe(func(channel string, b []byte) {
+		if msg, err := decodeMessage(channel, b); err == nil {
+			h.broadcast <- msg
+		}
+	})
+	return
 }
 
 type hub struct {
+	transport   Transport
+	policy      SlowConsumerPolicy
+	epoch       string
+	seq         uint32 // Last sequence number assigned on any channel
+	horizon     uint32 // Highest sequence number of any dropped log
+	logs        map[string]*replayLog
 	connections map[string]map[*connection]bool
 	broadcast   chan wsmessage
 	register    chan *connection
@@ -41,52 +94,152 @@ type hub struct {
 }
 
 func (h *hub) Run() {
+	sweep := time.NewTicker(replayLogSweepPeriod)
+	defer sweep.Stop()
 	for {
 		select {
 		case conn := <-h.update:
+			if conn.isClosed() {
+				break
+			}
 			for id := range h.connections {
 				if _, ok := h.connections[id][conn]; ok && !conn.hasChannel(id) {
-					delete(h.connections[id], conn)
+					h.leave(conn, id)
 				}
 			}
-			for _, id := range conn.channel_ids {
-				if _, ok := h.connections[id]; !ok {
-					h.connections[id] = make(map[*connection]bool)
+			for _, id := range conn.Channels() {
+				if h.connections[id][conn] {
+					continue
+				}
+				if !h.join(conn, id) {
+					h.remove(conn)
+					break
 				}
-				h.connections[id][conn] = true
 			}
 
 		case conn := <-h.register:
-			for _, id := range conn.channel_ids {
-				if _, ok := h.connections[id]; !ok {
-					h.connections[id] = make(map[*connection]bool)
+			if conn.isClosed() {
+				break
+			}
+			for _, id := range conn.Channels() {
+				if !h.join(conn, id) {
+					h.remove(conn)
+					break
 				}
-				h.connections[id][conn] = true
 			}
 
 		case conn := <-h.unregister:
-			for _, id := range conn.channel_ids {
-				delete(h.connections[id], conn)
-			}
-			close(conn.send)
+			h.remove(conn)
+			conn.Close()
 
 		case msg := <-h.broadcast:
-			if connections, ok := h.connections[msg.channel_id]; ok {
-				for conn := range connections {
-					select {
-					case conn.send <- msg:
-					default:
-						close(conn.send)
-						delete(connections, conn)
-					}
-				}
-			}
+			h.send(msg, time.Now())
+
+		case t := <-sweep.C:
+			h.sweepLogs(t)
+		}
+	}
+}
+
+// send assigns a message the next sequence number, retains it in its channel's log and delivers
+// it to the channel's connections
+func (h *hub) send(msg wsmessage, t time.Time) {
+	l, ok := h.logs[msg.channel_id]
+	if !ok {
+		// Broadcasts on the channel before the log was created are in a dropped log
+		l = &replayLog{floor: h.horizon}
+		h.logs[msg.channel_id] = l
+	}
+	h.seq++
+	msg.seq = h.seq
+	l.append(msg, t)
+	for conn := range h.connections[msg.channel_id] {
+		if !conn.deliver(msg, h.policy) {
+			h.remove(conn)
 		}
 	}
 }
 
+// sweepLogs drops the logs of channels without connections having no broadcasts since
+// replayLogIdle. Clients resuming from before a dropped log's last broadcast must resync.
+func (h *hub) sweepLogs(t time.Time) {
+	for id, l := range h.logs {
+		if len(h.connections[id]) > 0 || t.Sub(l.updated) < replayLogIdle {
+			continue
+		}
+		if l.seq > h.horizon {
+			h.horizon = l.seq
+		}
+		delete(h.logs, id)
+	}
+}
+
+// since returns the broadcasts on a channel following seq or false if any may no longer be retained
+func (h *hub) since(id string, seq uint32) (msgs []wsmessage, ok bool) {
+	if l, ok := h.logs[id]; ok {
+		return l.since(seq)
+	}
+	return nil, seq >= h.horizon && seq <= h.seq
+}
+
+// join adds a connection to a channel. Sequenced connections are sent the channel's current
+// sequence number or, if resuming, the broadcasts they missed. Returns false if the connection
+// was closed.
+func (h *hub) join(conn *connection, id string) bool {
+	if _, ok := h.connections[id]; !ok {
+		h.connections[id] = make(map[*connection]bool)
+	}
+	h.connections[id][conn] = true
+	if !conn.isSequenced() {
+		return true
+	}
+	var current = h.seq
+	if l, ok := h.logs[id]; ok {
+		current = l.seq
+	}
+	epoch, seq, ok := conn.takeResume(id)
+	if !ok {
+		return conn.deliver(seqMessage("seq", h.epoch, id, current), h.policy)
+	}
+	var missed []wsmessage
+	if epoch == h.epoch {
+		missed, ok = h.since(id, seq)
+	} else {
+		ok = false
+	}
+	if !ok || len(missed) >= conn.available() {
+		metrics.Add("resyncs", 1)
+		return conn.deliver(seqMessage("resync-required", h.epoch, id, current), h.policy)
+	}
+	for _, m := range missed {
+		if !conn.deliver(m, h.policy) {
+			return false
+		}
+	}
+	metrics.Add("replayed", int64(len(missed)))
+	return true
+}
+
+// remove deletes a connection from every channel
+func (h *hub) remove(conn *connection) {
+	for id := range h.connections {
+		h.leave(conn, id)
+	}
+}
+
+// leave deletes a connection from a channel, deleting the channel once it has no connections
+func (h *hub) leave(conn *connection, id string) {
+	delete(h.connections[id], conn)
+	if len(h.connections[id]) == 0 {
+		delete(h.connections, id)
+	}
+}
+
+// Broadcast publishes a message to the transport, delivering it locally if publishing fails
 func (h *hub) Broadcast(msg wsmessage) {
-	h.broadcast <- msg
+	if err := h.transport.Publish(msg.channel_id, encodeMessage(msg)); err != nil {
+		h.broadcast <- msg
+	}
 }
 
 func (h *hub) Register(conn *connection) {
@@ -99,6 +252,6 @@ func (h *hub) Unregister(conn *connection) {
 
 func (h *hub) Update(conn Connection, channels []string) {
 	c := conn.(*connection)
-	c.channel_ids = channels
+	c.setChannels(channels)
 	h.update <- c
 }
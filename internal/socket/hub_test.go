@@ -0,0 +1,249 @@
+package socket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testReceive pops the next queued message waiting up to a second
+func testReceive(t *testing.T, conn *connection) wsmessage {
+	for {
+		if m, ok := conn.pop(); ok {
+			return m
+		}
+		select {
+		case <-conn.notify:
+		case <-time.After(time.Second):
+			t.Fatal("Message not received")
+		}
+	}
+}
+
+func TestHubTransport(t *testing.T) {
+	broker := NewLocalBroker()
+	var hubs []*hub
+	for i := 0; i < 2; i++ {
+		h, err := NewHub(broker.Transport(), Disconnect)
+		require.Nil(t, err)
+		go h.Run()
+		hubs = append(hubs, h)
+	}
+	conn := CreateConnection([]string{"board-0001"}, nil)
+	hubs[1].Register(conn)
+
+	hubs[0].Broadcast(BinaryMsgFromBytes("board-0001", []byte{1, 2}).Coalesce("a"))
+	hubs[0].Broadcast(TextMsgFromBytes("bans", []byte("x")))
+	hubs[1].Broadcast(TextMsgFromBytes("board-0001", []byte("y")))
+
+	m := testReceive(t, conn)
+	require.Equal(t, []byte{1, 2}, m.data)
+	require.Equal(t, "a", m.key)
+	require.Equal(t, uint32(1), m.seq)
+	// Sequence numbers are shared by every channel of a hub
+	m = testReceive(t, conn)
+	require.Equal(t, "y", string(m.data))
+	require.Equal(t, uint32(3), m.seq)
+	_, ok := conn.pop()
+	require.False(t, ok)
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	var fill = func(h *hub) *connection {
+		conn := CreateConnection([]string{"global"}, nil)
+		h.Register(conn)
+		for i := 0; i < sendQueueSize; i++ {
+			require.Nil(t, conn.Write(TextMsgFromBytes("global", []byte(fmt.Sprint(i))).Coalesce(fmt.Sprint(i%2))))
+		}
+		return conn
+	}
+	var dropped = func() string {
+		if v := metrics.Get("dropped"); v != nil {
+			return v.String()
+		}
+		return "0"
+	}
+	for _, test := range []struct {
+		policy SlowConsumerPolicy
+		msg    wsmessage
+		closed bool
+		first  string
+		second string
+		last   string
+	}{
+		{Disconnect, TextMsgFromBytes("global", []byte("new")), true, "", "", ""},
+		{DropOldest, TextMsgFromBytes("global", []byte("new")), false, "1", "2", "new"},
+		// The replaced message keeps its position
+		{Coalesce, TextMsgFromBytes("global", []byte("new")).Coalesce("1"), false, "0", "new", "255"},
+		{Coalesce, TextMsgFromBytes("global", []byte("new")).Coalesce("2"), true, "", "", ""},
+	} {
+		h, err := NewHub(NewLocalBroker().Transport(), test.policy)
+		require.Nil(t, err)
+		go h.Run()
+		conn := fill(h)
+		n := dropped()
+		h.Broadcast(test.msg)
+		// Register a second connection to ensure the broadcast has been processed
+		h.Register(CreateConnection(nil, nil))
+
+		require.Equal(t, test.closed, conn.isClosed())
+		if test.closed {
+			require.NotNil(t, conn.Write(test.msg))
+			require.Equal(t, "Slow consumer", conn.reason)
+			require.NotEqual(t, n, dropped())
+			// Unregistering a disconnected connection must not panic
+			h.Unregister(conn)
+			continue
+		}
+		var received []string
+		for i := 0; i < sendQueueSize; i++ {
+			received = append(received, string(testReceive(t, conn).data))
+		}
+		require.Equal(t, test.first, received[0])
+		require.Equal(t, test.second, received[1])
+		require.Equal(t, test.last, received[sendQueueSize-1])
+		_, ok := conn.pop()
+		require.False(t, ok)
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	h, err := NewHub(NewLocalBroker().Transport(), Disconnect)
+	require.Nil(t, err)
+	go h.Run()
+	var sync = func() {
+		h.Register(CreateConnection(nil, nil))
+	}
+	for i := 0; i < 3; i++ {
+		h.Broadcast(TextMsgFromBytes("reports", []byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+
+	// New sequenced connections are told the current sequence
+	conn := CreateConnection([]string{"reports"}, nil)
+	conn.Resume("", nil)
+	h.Register(conn)
+	require.JSONEq(t, `{"type":"seq","epoch":"`+h.epoch+`","channel":"reports","seq":3}`, string(testReceive(t, conn).data))
+	h.Unregister(conn)
+	sync()
+
+	// Resuming replays missed broadcasts
+	conn = CreateConnection([]string{"reports", "global"}, nil)
+	conn.Resume(h.epoch, map[string]uint32{"reports": 1})
+	h.Register(conn)
+	for _, n := range []uint32{2, 3} {
+		m := testReceive(t, conn)
+		require.Equal(t, n, m.seq)
+		require.JSONEq(t, fmt.Sprintf(`{"channel":"reports","seq":%d,"msg":{"n":%d}}`, n, n-1), string(sequencedData(m)))
+	}
+	require.JSONEq(t, `{"type":"seq","epoch":"`+h.epoch+`","channel":"global","seq":3}`, string(testReceive(t, conn).data))
+	h.Unregister(conn)
+	sync()
+
+	// Unknown epochs and expired sequences require a resync
+	for _, test := range []struct {
+		epoch string
+		seq   uint32
+	}{
+		{"ffffffff", 1},
+		{h.epoch, 4},
+	} {
+		conn = CreateConnection([]string{"reports"}, nil)
+		conn.Resume(test.epoch, map[string]uint32{"reports": test.seq})
+		h.Register(conn)
+		require.JSONEq(t, `{"type":"resync-required","epoch":"`+h.epoch+`","channel":"reports","seq":3}`, string(testReceive(t, conn).data))
+		h.Unregister(conn)
+	}
+	sync()
+
+	// Resuming a channel joined later by update
+	conn = CreateConnection([]string{"global"}, nil)
+	conn.Resume(h.epoch, map[string]uint32{"global": 3})
+	h.Register(conn)
+	h.Broadcast(BinaryMsgFromBytes("board-0001", []byte{1}))
+	h.Broadcast(BinaryMsgFromBytes("board-0001", []byte{2}))
+	conn.Resume("", map[string]uint32{"board-0001": 4})
+	h.Update(conn, []string{"global", "board-0001"})
+	m := testReceive(t, conn)
+	require.Equal(t, append([]byte{0, 0, 0, 5, 10}, "board-0001\x02"...), sequencedData(m))
+}
+
+func TestReplayLog(t *testing.T) {
+	var l = &replayLog{}
+	for i := 1; i <= 3*replayLogSize; i++ {
+		m := TextMsgFromBytes("a", []byte(fmt.Sprint(i)))
+		m.seq = uint32(2 * i)
+		l.append(m, time.Now())
+	}
+	require.True(t, len(l.msgs) < 2*replayLogSize)
+	msgs, ok := l.since(uint32(4 * replayLogSize))
+	require.True(t, ok)
+	require.Len(t, msgs, replayLogSize)
+	require.Equal(t, uint32(4*replayLogSize+2), msgs[0].seq)
+	// Sequence numbers between a channel's broadcasts
+	msgs, ok = l.since(uint32(4*replayLogSize + 1))
+	require.True(t, ok)
+	require.Len(t, msgs, replayLogSize)
+	_, ok = l.since(uint32(4*replayLogSize - 1))
+	require.False(t, ok)
+	_, ok = l.since(uint32(6*replayLogSize + 1))
+	require.False(t, ok)
+}
+
+func TestHubSweepLogs(t *testing.T) {
+	h, err := NewHub(NewLocalBroker().Transport(), Disconnect)
+	require.Nil(t, err)
+	var now = time.Now()
+	conn := CreateConnection(nil, nil)
+	h.join(conn, "user-1")
+	h.send(TextMsgFromBytes("user-1", []byte("a")), now)
+	h.send(TextMsgFromBytes("user-2", []byte("b")), now)
+	h.send(TextMsgFromBytes("user-3", []byte("c")), now.Add(replayLogIdle))
+
+	// Only idle channels without connections are dropped
+	h.sweepLogs(now.Add(replayLogIdle))
+	require.Len(t, h.logs, 2)
+	require.NotNil(t, h.logs["user-1"])
+	require.NotNil(t, h.logs["user-3"])
+	require.Equal(t, uint32(2), h.horizon)
+
+	// Resuming a dropped channel requires a resync unless nothing was missed
+	_, ok := h.since("user-2", 1)
+	require.False(t, ok)
+	msgs, ok := h.since("user-2", 3)
+	require.True(t, ok)
+	require.Len(t, msgs, 0)
+	h.send(TextMsgFromBytes("user-2", []byte("d")), now)
+	msgs, ok = h.since("user-2", 2)
+	require.True(t, ok)
+	require.Len(t, msgs, 1)
+	require.Equal(t, uint32(4), msgs[0].seq)
+	_, ok = h.since("user-2", 1)
+	require.False(t, ok)
+
+	// Empty channels are deleted
+	h.remove(conn)
+	require.Len(t, h.connections, 0)
+}
+
+func TestConnectionOnClose(t *testing.T) {
+	conn := CreateConnection(nil, nil)
+	var calls = make(chan bool, 3)
+	conn.OnClose(func() { calls <- true })
+	conn.Close()
+	conn.Close()
+	conn.OnClose(func() { calls <- true })
+	for i := 0; i < 2; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatal("Close hook not run")
+		}
+	}
+	select {
+	case <-calls:
+		t.Fatal("Close hook run twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
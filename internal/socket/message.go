@@ -9,36 +9,46 @@ import (
 type Msg wsmessage
 
 func (m *Msg) Raw(channel_id string) wsmessage {
-	return wsmessage{m.msgType, channel_id, m.data}
+	return wsmessage{msgType: m.msgType, channel_id: channel_id, data: m.data, key: m.key}
 }
 
 type wsmessage struct {
 	msgType    int
 	channel_id string
 	data       []byte
+	key        string
+	// seq is assigned by the hub to broadcast messages
+	seq uint32
+}
+
+// Coalesce marks a message as superseding any queued message on the same channel with the same key
+// so that slow consumers under the Coalesce policy receive only the latest
+func (m wsmessage) Coalesce(key string) wsmessage {
+	m.key = key
+	return m
 }
 
 func Message(channel_id string, text string) wsmessage {
-	return wsmessage{websocket.TextMessage, channel_id, []byte(channel_id + "-" + text)}
+	return wsmessage{msgType: websocket.TextMessage, channel_id: channel_id, data: []byte(channel_id + "-" + text)}
 }
 
 func JsonMessage(channel_id string, data map[string]interface{}) wsmessage {
 	data["channel_id"] = channel_id
 	json_bytes, _ := json.Marshal(data)
-	return wsmessage{websocket.TextMessage, channel_id, json_bytes}
+	return wsmessage{msgType: websocket.TextMessage, channel_id: channel_id, data: json_bytes}
 }
 
 func JsonMessagePure(channel_id string, data interface{}) wsmessage {
 	json_bytes, _ := json.Marshal(data)
-	return wsmessage{websocket.TextMessage, channel_id, json_bytes}
+	return wsmessage{msgType: websocket.TextMessage, channel_id: channel_id, data: json_bytes}
 }
 
 func TextMsgFromBytes(channel_id string, b []byte) wsmessage {
-	return wsmessage{websocket.TextMessage, channel_id, b}
+	return wsmessage{msgType: websocket.TextMessage, channel_id: channel_id, data: b}
 }
 
 func BinaryMsgFromBytes(channel_id string, b []byte) wsmessage {
-	return wsmessage{websocket.BinaryMessage, channel_id, b}
+	return wsmessage{msgType: websocket.BinaryMessage, channel_id: channel_id, data: b}
 }
 
 func NewJsonRes(data interface{}) *Msg {
@@ -48,6 +58,6 @@ func NewJsonRes(data interface{}) *Msg {
 	} else {
 		json_bytes, _ = json.Marshal(data)
 	}
-	msg := Msg(wsmessage{websocket.TextMessage, "", json_bytes})
+	msg := Msg(wsmessage{msgType: websocket.TextMessage, channel_id: "", data: json_bytes})
 	return &msg
 }
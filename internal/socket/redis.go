@@ -0,0 +1,121 @@
+package socket
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+)
+
+const (
+	redisDefaultPrefix   = "cag:"
+	redisReconnectPeriod = time.Second
+)
+
+// NewRedisTransport returns a transport backed by Redis pub/sub. Channels are published under
+// the configured prefix so that several deployments may share a Redis server.
+func NewRedisTransport(cfg config.Redis) (t *redisTransport, err error) {
+	if len(cfg.Prefix) == 0 {
+		cfg.Prefix = redisDefaultPrefix
+	}
+	var opts []redis.DialOption
+	if len(cfg.Password) > 0 {
+		opts = append(opts, redis.DialPassword(cfg.Password))
+	}
+	t = &redisTransport{
+		prefix: cfg.Prefix,
+		pool: &redis.Pool{
+			MaxIdle:     4,
+			IdleTimeout: 5 * time.Minute,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", cfg.Addr, opts...)
+			},
+		},
+		closed: make(chan bool),
+	}
+	// Fail fast on misconfiguration
+	conn := t.pool.Get()
+	defer conn.Close()
+	if _, err = conn.Do("PING"); err != nil {
+		t.pool.Close()
+		return nil, err
+	}
+	return
+}
+
+type redisTransport struct {
+	prefix string
+	pool   *redis.Pool
+	closed chan bool
+	psc    *redis.PubSubConn
+	mutex  sync.Mutex
+}
+
+func (t *redisTransport) Publish(channel string, msg []byte) (err error) {
+	conn := t.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PUBLISH", t.prefix+channel, msg)
+	return
+}
+
+// Subscribe receives messages in the background reconnecting after connection failures.
+// Messages published while disconnected are lost.
+func (t *redisTransport) Subscribe(fn func(channel string, msg []byte)) (err error) {
+	psc, err := t.subscribe()
+	if err != nil {
+		return
+	}
+	go func() {
+		for {
+			t.receive(psc, fn)
+			select {
+			case <-t.closed:
+				return
+			case <-time.After(redisReconnectPeriod):
+			}
+			if p, err := t.subscribe(); err == nil {
+				psc = p
+			}
+		}
+	}()
+	return
+}
+
+func (t *redisTransport) subscribe() (psc *redis.PubSubConn, err error) {
+	psc = &redis.PubSubConn{Conn: t.pool.Get()}
+	if err = psc.PSubscribe(t.prefix + "*"); err != nil {
+		psc.Close()
+		return nil, err
+	}
+	t.mutex.Lock()
+	t.psc = psc
+	t.mutex.Unlock()
+	return
+}
+
+// receive delivers messages until the connection fails or is closed
+func (t *redisTransport) receive(psc *redis.PubSubConn, fn func(channel string, msg []byte)) {
+	defer psc.Close()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			fn(strings.TrimPrefix(v.Channel, t.prefix), v.Data)
+		case error:
+			return
+		}
+	}
+}
+
+func (t *redisTransport) Close() error {
+	close(t.closed)
+	t.mutex.Lock()
+	if t.psc != nil {
+		t.psc.PUnsubscribe()
+		t.psc.Close()
+	}
+	t.mutex.Unlock()
+	return t.pool.Close()
+}
@@ -0,0 +1,80 @@
+package socket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// replayLogSize is the number of recent broadcasts retained per channel for resuming clients
+const replayLogSize = 1024
+
+// replayLogIdle is how long the log of a channel without connections is retained after its last
+// broadcast
+var replayLogIdle = 10 * time.Minute
+
+// replayLog holds the most recent broadcasts on a channel. Sequence numbers are drawn from a
+// counter shared by every channel of a hub so that they keep increasing when a log is dropped and
+// later recreated. They are only meaningful within a hub's epoch.
+type replayLog struct {
+	floor   uint32 // Broadcasts up to floor may not be retained
+	seq     uint32
+	msgs    []wsmessage
+	updated time.Time
+}
+
+// append retains a message with its sequence number
+func (l *replayLog) append(m wsmessage, t time.Time) {
+	l.seq = m.seq
+	l.updated = t
+	l.msgs = append(l.msgs, m)
+	if len(l.msgs) >= 2*replayLogSize {
+		l.floor = l.msgs[len(l.msgs)-replayLogSize-1].seq
+		l.msgs = append([]wsmessage{}, l.msgs[len(l.msgs)-replayLogSize:]...)
+	}
+}
+
+// since returns the messages following seq or false if any may no longer be retained
+func (l *replayLog) since(seq uint32) (msgs []wsmessage, ok bool) {
+	if seq < l.floor || seq > l.seq {
+		return nil, false
+	}
+	i := sort.Search(len(l.msgs), func(i int) bool { return l.msgs[i].seq > seq })
+	return l.msgs[i:], true
+}
+
+// sequencedData wraps a broadcast for a sequenced connection. Binary messages are prefixed with
+// the sequence number, zero if not broadcast, and channel. Text messages are wrapped in a JSON
+// envelope.
+func sequencedData(m wsmessage) []byte {
+	if m.msgType == websocket.BinaryMessage {
+		b := make([]byte, 5, 5+len(m.channel_id)+len(m.data))
+		binary.BigEndian.PutUint32(b[0:4], m.seq)
+		b[4] = byte(len(m.channel_id))
+		b = append(b, m.channel_id...)
+		return append(b, m.data...)
+	}
+	var msg = json.RawMessage(m.data)
+	if !json.Valid(m.data) {
+		msg, _ = json.Marshal(string(m.data))
+	}
+	b, _ := json.Marshal(struct {
+		Channel string          `json:"channel"`
+		Seq     uint32          `json:"seq"`
+		Msg     json.RawMessage `json:"msg"`
+	}{m.channel_id, m.seq, msg})
+	return b
+}
+
+// seqMessage notifies a sequenced connection of a channel's current sequence number
+func seqMessage(msgType, epoch, channel string, seq uint32) wsmessage {
+	return JsonMessagePure("", map[string]interface{}{
+		"type":    msgType,
+		"epoch":   epoch,
+		"channel": channel,
+		"seq":     seq,
+	})
+}
@@ -0,0 +1,112 @@
+package socket
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+)
+
+// Transport fans messages out to the hub of every api instance subscribed to it
+type Transport interface {
+	// Publish sends a message to every subscriber including this process
+	Publish(channel string, msg []byte) error
+	// Subscribe delivers every published message to fn until the transport is closed
+	Subscribe(fn func(channel string, msg []byte)) error
+	Close() error
+}
+
+// NewTransport returns a broker transport if one is configured or otherwise an in-process transport
+func NewTransport(cfg config.Hub) (t Transport, err error) {
+	if cfg.Redis != nil && len(cfg.Redis.Addr) > 0 {
+		r, err := NewRedisTransport(*cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return NewLocalBroker().Transport(), nil
+}
+
+// encodeMessage prefixes message data with its websocket message type and coalesce key
+func encodeMessage(msg wsmessage) []byte {
+	var key = msg.key
+	if len(key) > 255 {
+		key = key[:255]
+	}
+	return append(append([]byte{byte(msg.msgType), byte(len(key))}, key...), msg.data...)
+}
+
+func decodeMessage(channel string, b []byte) (msg wsmessage, err error) {
+	if len(b) < 2 || len(b) < 2+int(b[1]) {
+		return msg, fmt.Errorf("Malformed message on channel %s", channel)
+	}
+	return wsmessage{
+		msgType:    int(b[0]),
+		channel_id: channel,
+		data:       b[2+int(b[1]):],
+		key:        string(b[2 : 2+int(b[1])]),
+	}, nil
+}
+
+// NewLocalBroker returns an in-process broker. Every transport of a broker receives every message
+// published to any of its transports, standing in for an external broker shared by several hubs.
+func NewLocalBroker() *localBroker {
+	return &localBroker{}
+}
+
+type localBroker struct {
+	transports []*localTransport
+	mutex      sync.RWMutex
+}
+
+// Transport returns a new transport connected to the broker
+func (b *localBroker) Transport() *localTransport {
+	t := &localTransport{broker: b}
+	b.mutex.Lock()
+	b.transports = append(b.transports, t)
+	b.mutex.Unlock()
+	return t
+}
+
+func (b *localBroker) remove(t *localTransport) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, t2 := range b.transports {
+		if t2 == t {
+			b.transports = append(b.transports[:i], b.transports[i+1:]...)
+			return
+		}
+	}
+}
+
+type localTransport struct {
+	broker *localBroker
+	subs   []func(channel string, msg []byte)
+	mutex  sync.RWMutex
+}
+
+func (t *localTransport) Publish(channel string, msg []byte) error {
+	t.broker.mutex.RLock()
+	defer t.broker.mutex.RUnlock()
+	for _, t2 := range t.broker.transports {
+		t2.mutex.RLock()
+		for _, fn := range t2.subs {
+			fn(channel, msg)
+		}
+		t2.mutex.RUnlock()
+	}
+	return nil
+}
+
+func (t *localTransport) Subscribe(fn func(channel string, msg []byte)) error {
+	t.mutex.Lock()
+	t.subs = append(t.subs, fn)
+	t.mutex.Unlock()
+	return nil
+}
+
+func (t *localTransport) Close() error {
+	t.broker.remove(t)
+	return nil
+}
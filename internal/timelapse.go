@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kevburnsjr/crypto-art-games/internal/config"
+	"github.com/kevburnsjr/crypto-art-games/internal/render"
+	"github.com/kevburnsjr/crypto-art-games/internal/repo"
+)
+
+// Timelapse exports board histories as animated GIFs or zipped PNG sequences.
+// Without -board every finished board without an existing export is rendered.
+func Timelapse(cfg *config.Api, args []string) (err error) {
+	var opts = render.DefaultTimelapseOptions
+	var fs = flag.NewFlagSet("timelapse", flag.ExitOnError)
+	var boardId = fs.Int("board", 0, "Board id (default all finished boards)")
+	var format = fs.String("format", "gif", "Output format (gif or zip)")
+	var out = fs.String("out", ".", "Output directory")
+	var root = fs.String("public", "public", "Static file root containing board backgrounds")
+	var force = fs.Bool("force", false, "Overwrite existing exports")
+	fs.IntVar(&opts.Step, "step", opts.Step, "Board frames per output frame")
+	fs.IntVar(&opts.MaxFrames, "max", opts.MaxFrames, "Maximum output frames")
+	fs.IntVar(&opts.Delay, "delay", opts.Delay, "Delay between output frames (100ths of a second)")
+	fs.IntVar(&opts.HoldDelay, "hold", opts.HoldDelay, "Delay on the final output frame (100ths of a second)")
+	fs.Parse(args)
+	if *format != "gif" && *format != "zip" {
+		return fmt.Errorf("Unknown format %s", *format)
+	}
+
+	rGame, err := repo.NewGame(cfg.Repo.Game)
+	if err != nil {
+		return
+	}
+	defer rGame.Close()
+	rBoard, err := repo.NewBoard(cfg.Repo.Board)
+	if err != nil {
+		return
+	}
+	defer rBoard.Close()
+	loader := render.NewLoader(*root, rGame, rBoard)
+
+	var boardIds []uint16
+	if *boardId > 0 {
+		boardIds = append(boardIds, uint16(*boardId))
+	} else {
+		all, err := rGame.AllSeries()
+		if err != nil {
+			return err
+		}
+		var now = uint32(time.Now().Unix())
+		for _, s := range all {
+			for _, b := range s.Boards {
+				if (b.Finished > 0 && b.Finished <= now) || (s.Finished > 0 && s.Finished <= now) {
+					boardIds = append(boardIds, b.ID)
+				}
+			}
+		}
+	}
+
+	if err = os.MkdirAll(*out, 0755); err != nil {
+		return
+	}
+	for _, id := range boardIds {
+		var path = filepath.Join(*out, fmt.Sprintf("board-%04x.%s", id, *format))
+		if _, err = os.Stat(path); err == nil && !*force && *boardId == 0 {
+			continue
+		}
+		if err = timelapse(loader, id, path, *format, opts); err != nil {
+			return
+		}
+		log.Printf("Wrote %s", path)
+	}
+	return nil
+}
+
+func timelapse(loader *render.Loader, boardId uint16, path, format string, opts render.TimelapseOptions) (err error) {
+	b, frames, err := loader.Load(boardId)
+	if err != nil {
+		return
+	}
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+	if format == "zip" {
+		err = render.WriteTimelapsePNG(file, b, frames, opts)
+	} else {
+		err = render.WriteTimelapseGIF(file, b, frames, opts)
+	}
+	if err2 := file.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return
+	}
+	return os.Rename(path+".tmp", path)
+}
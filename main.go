@@ -26,9 +26,43 @@ func main() {
 	}
 	var cfg = config.Api{}
 	yaml.Unmarshal(yamlFile, &cfg)
+	cfg.Repo.ApplyGlobal()
 
 	cfg.Hash = Hash
 
+	switch flag.Arg(0) {
+	case "timelapse":
+		if err = internal.Timelapse(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "backup":
+		if err = internal.Backup(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "restore":
+		if err = internal.Restore(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "export":
+		if err = internal.Export(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "import":
+		if err = internal.Import(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "check":
+		if err = internal.Check(&cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	var app = internal.NewApi(&cfg)
 
 	log.Println("Starting api")
@@ -13,8 +13,8 @@ Game.Board = (function(g){
     this.focused = false;
     this.prevx = -1;
     this.prevy = -1;
-    this.undo = [];
-    this.redo = [];
+    this.undos = [];
+    this.redos = [];
     this.i = 0;
     this.j = 0;
     this.dirty = true;
@@ -264,34 +264,39 @@ Game.Board = (function(g){
   };
 
   board.prototype.undo = async function() {
-    var self = this;
-    return new Promise((res, rej) => {
-      if (this.tile.active) {
-        rej();
-        return;
-      }
-      const timecode = self.undo.shift();
-      if (timecode === undefined) {
-        rej();
-        return;
-      }
-      const f = self.frames[self.frameIdx[timecode]];
-      if (f === undefined) {
-        rej();
-        return;
-      }
-      game.socket().undoFrame(self, f).then((e) => {
-        self.removeFrame(f);
-      });
+    if (this.tile.active) {
+      return Promise.reject();
+    }
+    const timecode = this.undos.pop();
+    const f = this.frames[this.frameIdx[timecode]];
+    if (f === undefined) {
+      return Promise.reject();
+    }
+    return this.game.getSocket().undoFrame(this, f).then(() => {
+      this.redos.push(timecode);
+    });
+  };
+
+  board.prototype.redo = async function() {
+    if (this.tile.active) {
+      return Promise.reject();
+    }
+    const timecode = this.redos.pop();
+    const f = this.frames[this.frameIdx[timecode]];
+    if (f === undefined) {
+      return Promise.reject();
+    }
+    return this.game.getSocket().redoFrame(this, f).then(() => {
+      this.undos.push(timecode);
     });
   };
 
   board.prototype.commitActive = async function() {
     var self = this;
     return this.tile.active ? this.tile.commit().then((frame) => {
-      self.redo = [];
+      self.redos = [];
       if (frame) {
-        self.undo.push(frame.timecode);
+        self.undos.push(frame.timecode);
       }
       Game.nav().flash("success", "Changes saved");
       self.uiDirty = true;
@@ -349,7 +354,8 @@ Game.Board = (function(g){
   }
 
   board.prototype.saveFrame = async function(f) {
-    if (this.enabled) {
+    // Frames resent after reconnecting are already indexed
+    if (this.enabled && !(f.timecode in this.frameIdx)) {
       f.date = new Date((this.created + f.timestamp) * 1000);
       this.frameIdx[f.timecode] = this.frames.length;
       this.frames.push(f)
@@ -380,6 +386,29 @@ Game.Board = (function(g){
     return;
   };
 
+  // updateFrame stores an undone or redone frame, redrawing its tile if the frame has been drawn
+  board.prototype.updateFrame = async function(f) {
+    const idx = this.frameIdx[f.timecode];
+    if (this.enabled && idx !== undefined) {
+      const existing = this.frames[idx];
+      // Rewind the tile to before the frame and replay it along with the tile's later frames
+      var replay = [];
+      for (var i = this.drawnOffset - 1; i >= idx; i--) {
+        if (this.frames[i].ti == f.ti && this.frames[i].tj == f.tj) {
+          this.undoFrame(this.frames[i]);
+          replay.unshift(this.frames[i]);
+        }
+      }
+      existing.deleted = f.deleted;
+      for (let rf of replay) {
+        rf.prev = [];
+        this.applyFrame(rf);
+      }
+      f = existing;
+    }
+    return this.store.setItem(f.timecode.toString(16).padStart(8, 0), f.toBytes());
+  };
+
   board.prototype.applyFrame = function(f) {
     if (this.enabled && f && !f.deleted) {
       this.tiles[f.ti][f.tj].applyFrame(f);
@@ -438,7 +467,7 @@ Game.Board = (function(g){
   };
 
   board.prototype.undoFrame = function(f) {
-    if (this.enabled && f) {
+    if (this.enabled && f && !f.deleted) {
       this.tiles[f.ti][f.tj].undoFrame(f);
     }
   };
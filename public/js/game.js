@@ -73,12 +73,24 @@ var Game = (function(g){
         }
         socket.initializing = true;
         socket.boardChangeCallback = callback ? callback : null;
+        if (board) {
+          socket.forget(boardChannel(board.id));
+        }
         board = await Game.Series.findActiveBoard(id);
         boardId = board.id;
         uiDirty = true;
         socket.send(JSON.stringify({
           type:       'board-init',
           boardId:    boardId,
+          timecode:   await board.getTimecode(),
+          snapshot:   true
+        }));
+      },
+      joinBoard: async function() {
+        // Frames since the board's timecode are sent again and missed broadcasts are resumed
+        socket.send(JSON.stringify({
+          type:       'board-init',
+          boardId:    board.id,
           timecode:   await board.getTimecode()
         }));
       },
@@ -102,18 +114,25 @@ var Game = (function(g){
         });
       },
       undoFrame: function(board, f) {
-        var fn;
+        return socket.updateFrame(board, f, 'frame-undo', 'frame-undone');
+      },
+      redoFrame: function(board, f) {
+        return socket.updateFrame(board, f, 'frame-redo', 'frame-redone');
+      },
+      updateFrame: function(board, f, type, resType) {
         return new Promise((resolve, reject) => {
-          socket.awaiting = f.timecode;
-          fn = function(e) {
-            if (e.timecode == socket.awaiting) {
+          socket.on([resType, 'err'], function(e) {
+            if (e.type == 'err') {
+              nav.flash("error", e.msg, 1500);
+              reject(e.msg);
+            } else if (e.timecode == f.timecode) {
               resolve(e);
             }
-          };
-          socket.on('frame-undone', fn);
-          socket.send(JSON.stringify({type:'frame-undo', boardId: board.id, timecode: f.timecode}));
+          });
+          socket.send(JSON.stringify({type: type, boardId: board.id, timecode: f.timecode}));
         }).finally(() => {
-          socket.off('frame-undone');
+          socket.off(resType);
+          socket.off('err');
         });
       },
       lockTile: function(t) {
@@ -224,6 +243,27 @@ var Game = (function(g){
         return socket.serial(e.type, e);
       }
     });
+    socket.on('board-snapshot', async (e) => {
+      // Composite tile frames replace the board's history up to the snapshot
+      for (let t of e.tiles || []) {
+        const b = Uint8Array.from(atob(t), c => c.charCodeAt(0));
+        await board.saveFrame(Game.Frame.fromBytes(b.buffer));
+      }
+      // Tiles are sent in tile order so the snapshot's timecode is authoritative
+      board.timecode = e.timecode;
+      await board.setTimecode(e.timecode);
+    });
+    socket.on('frame-update', async (e) => {
+      // Undone and redone frames are updated in place rather than appended
+      const b = Uint8Array.from(atob(e.frame), c => c.charCodeAt(0));
+      await board.updateFrame(Game.Frame.fromBytes(b.buffer));
+    });
+    socket.on('resync-required', async (e) => {
+      // Bans, users and reports are synced from the indexes sent on connect
+      if (board && e.channel == boardChannel(board.id)) {
+        await socket.joinBoard();
+      }
+    });
     socket.on('board-init-complete', async (e) => {
       if (board != null) {
         nav.showHeart(e.bucket);
@@ -247,6 +287,10 @@ var Game = (function(g){
     });
     socket.on('report', function(e) {
       store.reports.setItem([e.targetID, e.boardID, e.timecode, e.userID].join("-"), e);
+      if (e.id > reportIdx) {
+        reportIdx = e.id;
+        store.global.setItem("reportIdx", reportIdx.toString(16).padStart(4, 0));
+      }
       nav.showMod();
     });
     socket.on('report-clear', async function(e) {
@@ -331,6 +375,12 @@ var Game = (function(g){
         }
         Game.Series.init(e.series);
         nav.showSeries(Game.Series.list());
+        if (board && board.id == boardId) {
+          // Reconnected
+          socket.joinBoard();
+          resolve();
+          return;
+        }
         socket.changeBoard(boardId, board => {
           if (focused) {
             board.setFocus(Math.floor(tile/16), tile%16);
@@ -601,6 +651,10 @@ var Game = (function(g){
       setZoom();
       setHash();
     }
+    if (k == "z" && e.ctrlKey) {
+      e.preventDefault();
+      (e.shiftKey ? board.redo() : board.undo()).catch(() => {});
+    }
     if (k == "\\" && e.ctrlKey) {
       e.preventDefault();
       if (nav.toggleDemoMode()) {
@@ -803,6 +857,10 @@ var Game = (function(g){
     }
   };
 
+  var boardChannel = function(id) {
+    return `board-${id.toString(16).padStart(4, 0)}`;
+  };
+
   var getSocket = function() {
     return socket;
   };
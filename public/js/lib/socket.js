@@ -8,7 +8,9 @@ Game.socket = (function (g) {
       connect:    null,
       connected:  false,
       connection: null,
-      failures:   0
+      failures:   0,
+      epoch:      '',
+      seqs:       {}
     });
     g.object.extend(this, data);
 
@@ -21,6 +23,46 @@ Game.socket = (function (g) {
       self.emit('stop');
     };
 
+    // resumeQuery returns query parameters resuming each channel from the last broadcast received
+    var resumeQuery = function() {
+      var q = 'epoch=' + encodeURIComponent(self.epoch);
+      for (let channel in self.seqs) {
+        q += `&seq-${encodeURIComponent(channel)}=${self.seqs[channel]}`;
+      }
+      return q;
+    };
+
+    // unwrap records the sequence number of a broadcast returning the message it carries
+    var unwrap = function(data) {
+      if (data instanceof ArrayBuffer) {
+        const v = new DataView(data);
+        const n = v.getUint8(4);
+        record(new TextDecoder().decode(new Uint8Array(data, 5, n)), v.getUint32(0));
+        return data.slice(5 + n);
+      }
+      const e = JSON.parse(data);
+      if (e.type === undefined && e.msg !== undefined) {
+        record(e.channel, e.seq);
+        return typeof e.msg == 'string' ? e.msg : JSON.stringify(e.msg);
+      }
+      if (e.type == 'seq' || e.type == 'resync-required') {
+        self.epoch = e.epoch;
+        self.seqs[e.channel] = e.seq;
+      }
+      return data;
+    };
+
+    var record = function(channel, seq) {
+      if (seq > 0) {
+        self.seqs[channel] = seq;
+      }
+    };
+
+    // forget stops resuming a channel the client has left
+    this.forget = function(channel) {
+      delete self.seqs[channel];
+    };
+
     var backoff = function() {
       return Math.min((self.failures+1)*1000, 64 * 1000);
     }
@@ -40,6 +82,7 @@ Game.socket = (function (g) {
             console.log("bad url");
             return;
           }
+          url += (url.indexOf('?') < 0 ? '?' : '&') + resumeQuery();
           self.connection = new WebSocket(scheme+"://"+host+port+url);
           self.connection.binaryType = "arraybuffer";
           self.connection.onclose = function(evt) {
@@ -58,7 +101,7 @@ Game.socket = (function (g) {
           }
           self.connection.onmessage = function(evt) {
             try {
-              self.serial('message', evt.data);
+              self.serial('message', unwrap(evt.data));
             } catch(e) {
               g.log('Socket event parse failed', evt);
               g.log(e);